@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"gograph/internal/flow"
+	"gograph/internal/load"
+	"gograph/internal/log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	loadVus      int
+	loadDuration time.Duration
+	loadRps      int
+	loadRampUp   time.Duration
+	loadInterval time.Duration
+	loadSeed     int64
+	loadOutputs  []string
+	loadEnv      string
+	loadState    []string
+	loadDotEnvs  []string
+)
+
+// loadCmd represents the load command
+var loadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "Run a flow as a load test",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatalln("Specify a flow file")
+		}
+
+		loadEnvFiles(loadDotEnvs, cmd.Flags().Changed("env-file"))
+
+		flowDef, err := flow.LoadFlowDefinitionFile(args[0])
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := applyEnvironment(flowDef, loadEnv, loadState); err != nil {
+			log.Fatalln(err)
+		}
+
+		options := &load.Options{
+			Vus:      max(loadVus, 1),
+			Duration: loadDuration,
+			Rps:      loadRps,
+			RampUp:   loadRampUp,
+			Interval: loadInterval,
+			Seed:     loadSeed,
+		}
+		if !cmd.Flags().Changed("seed") {
+			options.Seed = time.Now().UnixNano()
+		}
+
+		// Stop the test on Ctrl+C, the running iterations are completed
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		options.Context = ctx
+
+		log.Printf("[%v] running %v virtual users for %v", flowDef.Name, options.Vus, options.Duration)
+		result, err := load.Run(flowDef, options)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		// Keep the standard output clean when a result is written to it
+		summary := new(strings.Builder)
+		result.Summarize(summary)
+		out := func(v ...any) { log.Out(v...) }
+		for _, target := range loadOutputs {
+			if !strings.Contains(target, "=") || strings.HasSuffix(target, "=-") {
+				out = log.Print
+			}
+		}
+		out(summary)
+
+		for _, target := range loadOutputs {
+			err := result.WriteTarget(target)
+			if err != nil {
+				log.Fatalln("Unable to write results", target, err)
+			}
+		}
+	},
+}
+
+func init() {
+	flowCmd.AddCommand(loadCmd)
+	loadCmd.Flags().IntVarP(&loadVus, "vus", "", 1, "Number of virtual users running the flow at the same time")
+	loadCmd.Flags().DurationVarP(&loadDuration, "duration", "", 30*time.Second, "Duration of the test")
+	loadCmd.Flags().IntVarP(&loadRps, "rps", "", 0, "Maximum number of requests per second, no limit by default")
+	loadCmd.Flags().DurationVarP(&loadRampUp, "ramp-up", "", 0, "Time to start all the virtual users")
+	loadCmd.Flags().DurationVarP(&loadInterval, "interval", "", time.Second, "Interval of the points of the time series")
+	loadCmd.Flags().StringVarP(&loadEnv, "env", "e", "", "Environment of the flow, defined in the flow or in env/<name>.yml")
+	loadCmd.Flags().StringArrayVarP(&loadDotEnvs, "env-file", "", []string{".env"}, "Load environment variables from a file, the variables already set are kept")
+	loadCmd.Flags().StringArrayVarP(&loadState, "set", "", nil, "Override a value of the state: KEY=VALUE")
+	loadCmd.Flags().Int64VarP(&loadSeed, "seed", "", 0, "Seed for the random values")
+	loadCmd.Flags().StringArrayVarP(&loadOutputs, "out", "o", nil, "Write the results: csv=<file> for the time series or json=<file> for the results and the time series, without file the results are written to the standard output")
+}
@@ -1,15 +1,37 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"gograph/internal/flow"
+	"gograph/internal/har"
 	"gograph/internal/log"
+	"gograph/internal/report"
+	"gograph/internal/util"
+	"io/fs"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	until string
+	selection flow.Selection
+	seed      int64
+
+	updateSnapshots bool
+	reports         []string
+
+	harFile   string
+	harRedact []string
+
+	parallel int
+
+	environment string
+	stateValues []string
+	envFiles    []string
 )
 
 // runCmd represents the run command
@@ -22,37 +44,171 @@ var runCmd = &cobra.Command{
 			log.Fatalln("Specify flow file")
 		}
 
-		finalSummary := new(strings.Builder)
+		// Keep the standard output clean when a report is written to it
+		out := func(v ...any) { log.Out(v...) }
+		for _, target := range reports {
+			if !strings.Contains(target, "=") || strings.HasSuffix(target, "=-") {
+				out = log.Print
+			}
+		}
 
+		// Record the traffic of all the flows
+		var recorder *har.Recorder
+		if len(harFile) > 0 {
+			recorder = har.NewRecorder(nil, harRedact)
+		}
+
+		// Interrupt the flows on the first Ctrl+C, the teardown steps still run.
+		// A second Ctrl+C stops the process
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		loadEnvFiles(envFiles, cmd.Flags().Changed("env-file"))
+
+		// Load all the flows before running them
+		flows := []*flow.FlowDefinition{}
 		for _, file := range args {
 			flowDef, err := flow.LoadFlowDefinitionFile(file)
 			if err != nil {
 				log.Fatalln(err)
 			}
+			if err := applyEnvironment(flowDef, environment, stateValues); err != nil {
+				log.Fatalln(err)
+			}
+			// One run for each combination of the matrix
+			flows = append(flows, flowDef.Expand()...)
+		}
 
-			flowRunner := flow.NewFlowRunner(flowDef)
+		// Select the steps to run across all the flows
+		flows = selection.Filter(flows)
+		if len(flows) == 0 {
+			log.Fatalln("No step selected")
+		}
+
+		runners := make([]*flow.FlowRunner, len(flows))
+		for i, flowDef := range flows {
+			runners[i] = flow.NewFlowRunner(flowDef)
+		}
 
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, max(parallel, 1))
+		summaries := make([]string, len(runners))
+		for i, flowRunner := range runners {
 			options := &flow.RunOption{
-				BreakAfterStepNamed: until,
+				UpdateSnapshots: updateSnapshots,
+				Context:         ctx,
 			}
-			flowRunner.Run(options)
+			// Each flow has its own seed, printed in its summary, so that the
+			// flows don't generate the same values
+			if cmd.Flags().Changed("seed") {
+				flowSeed := seed + int64(i)
+				options.Seed = &flowSeed
+			}
+			if recorder != nil {
+				options.Transport = recorder
+			}
+			// Keep the output of each flow grouped
+			if parallel > 1 {
+				options.Logger = options.Logger.Buffered()
+			}
+
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int, flowRunner *flow.FlowRunner) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				flowRunner.Run(options)
 
-			// Print the result
-			localSummary := new(strings.Builder)
-			flowRunner.Summarize(localSummary)
-			log.Out(localSummary)
+				// Print the result
+				localSummary := new(strings.Builder)
+				flowRunner.Summarize(localSummary)
 
-			// Save for final result
-			finalSummary.WriteString(localSummary.String())
+				mutex.Lock()
+				defer mutex.Unlock()
+				options.Logger.Flush()
+				out(localSummary)
+
+				// Save for final result
+				summaries[i] = localSummary.String()
+			}(i, flowRunner)
+		}
+		wg.Wait()
+
+		finalSummary := strings.Join(summaries, "")
+		out("\nAll flows have completed\n")
+		out(finalSummary)
+
+		// Write the reports
+		runReport := report.New(runners)
+		for _, target := range reports {
+			err := runReport.WriteTarget(target)
+			if err != nil {
+				log.Fatalln("Unable to write report", target, err)
+			}
+		}
+
+		if recorder != nil {
+			err := recorder.WriteFile(harFile)
+			if err != nil {
+				log.Fatalln("Unable to write HAR file", harFile, err)
+			}
 		}
 
-		log.Outln("\nAll flows have completed")
-		log.Out(finalSummary)
+		if ctx.Err() != nil {
+			os.Exit(130)
+		}
+		for _, runner := range runners {
+			if runner.HasError() {
+				os.Exit(1)
+			}
+		}
 
 	},
 }
 
 func init() {
 	flowCmd.AddCommand(runCmd)
-	runCmd.Flags().StringVarP(&until, "until", "u", "", "Run until the specified step")
+	runCmd.Flags().StringVarP(&selection.Until, "until", "u", "", "Stop after the specified step")
+	runCmd.Flags().StringVarP(&selection.From, "from", "", "", "Start with the specified step")
+	runCmd.Flags().StringSliceVarP(&selection.Only, "only", "", nil, "Run only the steps matching the names or globs")
+	runCmd.Flags().StringSliceVarP(&selection.Skip, "skip", "", nil, "Don't run the steps matching the names or globs")
+	runCmd.Flags().StringSliceVarP(&selection.Tags, "tags", "", nil, "Run only the steps with one of the tags, !<tag> excludes the steps with the tag")
+	runCmd.Flags().StringVarP(&environment, "env", "e", "", "Environment of the flows, defined in the flow or in env/<name>.yml")
+	runCmd.Flags().StringArrayVarP(&envFiles, "env-file", "", []string{".env"}, "Load environment variables from a file, the variables already set are kept")
+	runCmd.Flags().StringArrayVarP(&stateValues, "set", "", nil, "Override a value of the state: KEY=VALUE")
+	runCmd.Flags().Int64VarP(&seed, "seed", "", 0, "Seed for the random values, overrides the seed of the flow files")
+	runCmd.Flags().BoolVarP(&updateSnapshots, "update-snapshots", "", false, "Overwrite the snapshots with the current responses")
+	runCmd.Flags().StringArrayVarP(&reports, "report", "", nil, "Write a report: junit=<file>, json=<file>, tap=<file> or html=<file>, without file the report is written to the standard output")
+	runCmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "Number of flows run at the same time")
+	runCmd.Flags().StringVarP(&harFile, "har", "", "", "Record the http traffic in a HAR file")
+	runCmd.Flags().StringSliceVarP(&harRedact, "har-redact", "", har.DefaultRedact, "Headers whose values are redacted in the HAR file")
+}
+
+// Apply the environment and the state overrides to a flow
+func applyEnvironment(flowDef *flow.FlowDefinition, environment string, stateValues []string) error {
+	if len(environment) > 0 {
+		if err := flowDef.ApplyEnvironment(environment); err != nil {
+			return err
+		}
+	}
+	return flowDef.SetState(stateValues)
+}
+
+// Load the .env files, the default file is ignored when it doesn't exist
+func loadEnvFiles(files []string, explicit bool) {
+	for _, file := range files {
+		err := util.LoadDotEnv(file)
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			continue
+		}
+		if err != nil {
+			log.Fatalln("Unable to load env file", file, err)
+		}
+	}
 }
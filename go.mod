@@ -3,9 +3,13 @@ module gograph
 go 1.22.0
 
 require (
+	github.com/PaesslerAG/gval v1.0.0
 	github.com/PaesslerAG/jsonpath v0.1.1
 	github.com/Pallinder/go-randomdata v1.2.0
 	github.com/chanced/caps v1.0.2
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/google/uuid v1.6.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/spf13/cobra v1.8.0
 	github.com/wundergraph/graphql-go-tools/v2 v2.0.0-rc.8
 	github.com/yargevad/filepathx v1.0.0
@@ -13,7 +17,6 @@ require (
 )
 
 require (
-	github.com/PaesslerAG/gval v1.0.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
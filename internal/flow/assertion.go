@@ -0,0 +1,371 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"gograph/internal/template"
+	"gograph/internal/util"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Assertion
+// ----------------------------------------
+//
+// A set of checks applied to a value extracted from a response.
+// The expected values are go templates, a value made of a single
+// expression keeps its type.
+type Assertion struct {
+	// The value as a string must match the regexp
+	Match string `yaml:",omitempty"`
+	// The value as a string must be identical
+	Exact string `yaml:",omitempty"`
+
+	// Deep JSON equality
+	Equals    interface{} `yaml:",omitempty"`
+	NotEquals interface{} `yaml:"notEquals,omitempty"`
+
+	// Number or string comparison
+	Gt  interface{} `yaml:",omitempty"`
+	Gte interface{} `yaml:",omitempty"`
+	Lt  interface{} `yaml:",omitempty"`
+	Lte interface{} `yaml:",omitempty"`
+
+	// A substring, an array element or an object key
+	Contains interface{} `yaml:",omitempty"`
+	// The value is one of the list
+	In []interface{} `yaml:",omitempty"`
+
+	// Length of a string, array or object
+	Length    *int `yaml:",omitempty"`
+	MinLength *int `yaml:"minLength,omitempty"`
+	MaxLength *int `yaml:"maxLength,omitempty"`
+
+	// string, number, boolean, array, object or null
+	Type string `yaml:",omitempty"`
+
+	// The value must exist (the default), or not exist with `exists: false`
+	Exists    *bool `yaml:",omitempty"`
+	NotExists bool  `yaml:"notExists,omitempty"`
+	Empty     *bool `yaml:",omitempty"`
+
+	// Apply an assertion to every element of an array
+	Each *Assertion `yaml:",omitempty"`
+}
+
+// The null expected by `equals: null` or `notEquals: null`, the yaml null
+// is decoded as nil which means that the check is not set
+type jsonNull struct{}
+
+func (jsonNull) MarshalJSON() ([]byte, error) { return []byte("null"), nil }
+
+func (jsonNull) MarshalYAML() (interface{}, error) { return nil, nil }
+
+// Set the null expected values from the keys of the yaml
+func (a *Assertion) setNulls(keys map[string]interface{}) {
+	for key, value := range keys {
+		switch {
+		case key == "equals" && value == nil:
+			a.Equals = jsonNull{}
+		case key == "notEquals" && value == nil:
+			a.NotEquals = jsonNull{}
+		case key == "each" && a.Each != nil:
+			if each, ok := value.(map[interface{}]interface{}); ok {
+				eachKeys := make(map[string]interface{}, len(each))
+				for k, v := range each {
+					eachKeys[fmt.Sprint(k)] = v
+				}
+				a.Each.setNulls(eachKeys)
+			}
+		}
+	}
+}
+
+// Decode a type including an assertion and keep its null expected values
+func unmarshalAssertion(unmarshal func(interface{}) error, plain interface{}, a *Assertion) error {
+	if err := unmarshal(plain); err != nil {
+		return err
+	}
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	a.setNulls(keys)
+	return nil
+}
+
+// The value is expected not to exist
+func (a *Assertion) absent() bool {
+	return a.NotExists || (a.Exists != nil && !*a.Exists)
+}
+
+// Normalize a value to its JSON form so that values coming from yaml,
+// templates and responses can be compared
+func normalizeJson(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return v
+	}
+	return normalized
+}
+
+// The string form of a value, strings are returned as is and the other values as JSON
+func stringValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return util.JsonPrint(v)
+}
+
+// Name of the JSON type of a normalized value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Length of a string, array or object
+func jsonLength(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case string:
+		return utf8.RuneCountInString(t), true
+	case []interface{}:
+		return len(t), true
+	case map[string]interface{}:
+		return len(t), true
+	default:
+		return 0, false
+	}
+}
+
+// Compare two numbers or two strings, returns -1, 0 or 1
+func compareJson(a, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("unable to compare %v with %v", util.JsonPrint(a), util.JsonPrint(b))
+}
+
+// Check the assertion against a value
+//
+// found is false when the value doesn't exist in the response.
+// The result is the list of failures, empty if the value is valid.
+func (a *Assertion) Check(data interface{}, found bool, context *StepTemplateContext) []string {
+	failures := []string{}
+	failf := func(format string, args ...any) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	// Existence
+	// ----------------------------------------
+	if a.absent() {
+		if found {
+			name := "notExists"
+			if !a.NotExists {
+				name = "exists"
+			}
+			failf("%v: expected no value, got %v", name, util.JsonPrint(data))
+		}
+		return failures
+	}
+	if !found {
+		failf("exists: expected a value, got nothing")
+		return failures
+	}
+
+	// Run the templates of the expected values
+	expected := func(v interface{}) interface{} {
+		parsed, err := template.RunValueTemplates(v, context)
+		if err != nil {
+			failf("invalid expected value %v: %v", v, err)
+			return v
+		}
+		return normalizeJson(parsed)
+	}
+
+	actual := normalizeJson(data)
+
+	// Regexp match
+	// ----------------------------------------
+	match := strings.TrimSpace(a.Match)
+	if len(match) > 0 {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			failf("match: invalid regexp %v: %v", match, err)
+		} else if !re.MatchString(stringValue(actual)) {
+			failf("match: expected a value matching %v, got %v", match, util.JsonPrint(actual))
+		}
+	}
+
+	// Exact match on the string form
+	// ----------------------------------------
+	exact := strings.TrimSpace(a.Exact)
+	if len(exact) > 0 {
+		exact = template.RunTemplateOrUnparsed(exact, context)
+		if stringValue(actual) != exact {
+			failf("exact: expected %v, got %v", exact, stringValue(actual))
+		}
+	}
+
+	// Equality
+	// ----------------------------------------
+	if a.Equals != nil {
+		e := expected(a.Equals)
+		if !reflect.DeepEqual(actual, e) {
+			failf("equals: expected %v, got %v", util.JsonPrint(e), util.JsonPrint(actual))
+		}
+	}
+	if a.NotEquals != nil {
+		e := expected(a.NotEquals)
+		if reflect.DeepEqual(actual, e) {
+			failf("notEquals: expected a value different from %v", util.JsonPrint(e))
+		}
+	}
+
+	// Comparison
+	// ----------------------------------------
+	comparisons := []struct {
+		name     string
+		operator string
+		expected interface{}
+		valid    func(int) bool
+	}{
+		{"gt", ">", a.Gt, func(c int) bool { return c > 0 }},
+		{"gte", ">=", a.Gte, func(c int) bool { return c >= 0 }},
+		{"lt", "<", a.Lt, func(c int) bool { return c < 0 }},
+		{"lte", "<=", a.Lte, func(c int) bool { return c <= 0 }},
+	}
+	for _, comparison := range comparisons {
+		if comparison.expected == nil {
+			continue
+		}
+		e := expected(comparison.expected)
+		c, err := compareJson(actual, e)
+		if err != nil {
+			failf("%v: %v", comparison.name, err)
+		} else if !comparison.valid(c) {
+			failf("%v: expected a value %v %v, got %v", comparison.name, comparison.operator, util.JsonPrint(e), util.JsonPrint(actual))
+		}
+	}
+
+	// Contains
+	// ----------------------------------------
+	if a.Contains != nil {
+		e := expected(a.Contains)
+		contains := false
+		switch t := actual.(type) {
+		case string:
+			contains = strings.Contains(t, stringValue(e))
+		case []interface{}:
+			for _, item := range t {
+				if reflect.DeepEqual(item, e) {
+					contains = true
+					break
+				}
+			}
+		case map[string]interface{}:
+			_, contains = t[stringValue(e)]
+		}
+		if !contains {
+			failf("contains: expected a value containing %v, got %v", util.JsonPrint(e), util.JsonPrint(actual))
+		}
+	}
+
+	// In
+	// ----------------------------------------
+	if a.In != nil {
+		e := expected(a.In)
+		in := false
+		if list, ok := e.([]interface{}); ok {
+			for _, item := range list {
+				if reflect.DeepEqual(actual, item) {
+					in = true
+					break
+				}
+			}
+		}
+		if !in {
+			failf("in: expected one of %v, got %v", util.JsonPrint(e), util.JsonPrint(actual))
+		}
+	}
+
+	// Length
+	// ----------------------------------------
+	if a.Length != nil || a.MinLength != nil || a.MaxLength != nil {
+		length, ok := jsonLength(actual)
+		switch {
+		case !ok:
+			failf("length: expected a string, array or object, got %v", util.JsonPrint(actual))
+		case a.Length != nil && length != *a.Length:
+			failf("length: expected %v, got %v", *a.Length, length)
+		case a.MinLength != nil && length < *a.MinLength:
+			failf("minLength: expected at least %v, got %v", *a.MinLength, length)
+		case a.MaxLength != nil && length > *a.MaxLength:
+			failf("maxLength: expected at most %v, got %v", *a.MaxLength, length)
+		}
+	}
+
+	// Type
+	// ----------------------------------------
+	if len(a.Type) > 0 && jsonType(actual) != a.Type {
+		failf("type: expected %v, got %v (%v)", a.Type, jsonType(actual), util.JsonPrint(actual))
+	}
+
+	// Empty
+	// ----------------------------------------
+	if a.Empty != nil {
+		length, ok := jsonLength(actual)
+		empty := actual == nil || (ok && length == 0)
+		if empty != *a.Empty {
+			failf("empty: expected %v, got %v", *a.Empty, util.JsonPrint(actual))
+		}
+	}
+
+	// Each
+	// ----------------------------------------
+	if a.Each != nil {
+		list, ok := actual.([]interface{})
+		if !ok {
+			failf("each: expected an array, got %v", util.JsonPrint(actual))
+		}
+		for i, item := range list {
+			for _, failure := range a.Each.Check(item, true, context) {
+				failf("[%v] %v", i, failure)
+			}
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,93 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAssertion(t *testing.T) {
+	tests := []struct {
+		assertion string
+		data      interface{}
+		found     bool
+		failures  []string
+	}{
+		{"match: ^a+$", "aaa", true, nil},
+		{"match: ^a+$", "abc", true, []string{`match: expected a value matching ^a+$, got "abc"`}},
+		{"match: '['", "abc", true, []string{"match: invalid regexp [: error parsing regexp: missing closing ]: `[`"}},
+		{"exact: '12'", 12, true, nil},
+		{"exact: abc", "abd", true, []string{"exact: expected abc, got abd"}},
+
+		{"equals: {a: [1, 2]}", map[string]interface{}{"a": []interface{}{1, 2}}, true, nil},
+		{"equals: 2", "2", true, []string{`equals: expected 2, got "2"`}},
+		{`equals: "{{ .State.ID }}"`, 42, true, nil},
+		{"equals: null", nil, true, nil},
+		{"equals: null", "a", true, []string{`equals: expected null, got "a"`}},
+		{"equals: ~", 0, true, []string{"equals: expected null, got 0"}},
+		{"notEquals: 1", 2, true, nil},
+		{"notEquals: 1", 1, true, []string{"notEquals: expected a value different from 1"}},
+		{"notEquals: null", 1, true, nil},
+		{"notEquals: null", nil, true, []string{"notEquals: expected a value different from null"}},
+
+		{"gt: 1", 2, true, nil},
+		{"gt: 2", 2, true, []string{"gt: expected a value > 2, got 2"}},
+		{"gte: 2", 2, true, nil},
+		{"gte: 3", 2, true, []string{"gte: expected a value >= 3, got 2"}},
+		{"lt: b", "a", true, nil},
+		{"lt: a", "b", true, []string{`lt: expected a value < "a", got "b"`}},
+		{"lte: 2", 2, true, nil},
+		{"lte: 1", 2, true, []string{"lte: expected a value <= 1, got 2"}},
+		{"gt: 1", "2", true, []string{`gt: unable to compare "2" with 1`}},
+
+		{"contains: ell", "hello", true, nil},
+		{"contains: 2", []interface{}{1, 2}, true, nil},
+		{"contains: id", map[string]interface{}{"id": 1}, true, nil},
+		{"contains: x", "hello", true, []string{`contains: expected a value containing "x", got "hello"`}},
+		{"in: [a, b]", "b", true, nil},
+		{"in: [a, b]", "c", true, []string{`in: expected one of ["a","b"], got "c"`}},
+
+		{"length: 3", "abc", true, nil},
+		{"length: 2", []interface{}{1}, true, []string{"length: expected 2, got 1"}},
+		{"length: 1", 1, true, []string{"length: expected a string, array or object, got 1"}},
+		{"minLength: 2", "a", true, []string{"minLength: expected at least 2, got 1"}},
+		{"maxLength: 1", "ab", true, []string{"maxLength: expected at most 1, got 2"}},
+
+		{"type: number", 1, true, nil},
+		{"type: array", "a", true, []string{`type: expected array, got string ("a")`}},
+		{"empty: true", "", true, nil},
+		{"empty: true", nil, true, nil},
+		{"empty: false", []interface{}{}, true, []string{"empty: expected false, got []"}},
+
+		{"each: {type: string}", []interface{}{"a", 1}, true, []string{"[1] type: expected string, got number (1)"}},
+		{"each: {equals: null}", []interface{}{nil, 1}, true, []string{"[1] equals: expected null, got 1"}},
+		{"each: {type: string}", "a", true, []string{`each: expected an array, got "a"`}},
+
+		{"type: string", nil, false, []string{"exists: expected a value, got nothing"}},
+		{"exists: true", nil, false, []string{"exists: expected a value, got nothing"}},
+		{"exists: true", nil, true, nil},
+		{"exists: false", nil, false, nil},
+		{"exists: false", 1, true, []string{"exists: expected no value, got 1"}},
+		{"notExists: true", nil, false, nil},
+		{"notExists: true", 1, true, []string{"notExists: expected no value, got 1"}},
+	}
+
+	f := NewFlowDefinition("")
+	f.State["ID"] = 42
+	context := f.templateContext(&FlowStep{}, log.Discard)
+	for _, test := range tests {
+		var value FlowStepValue
+		if err := yaml.Unmarshal([]byte(test.assertion), &value); err != nil {
+			t.Fatalf("%v: %v", test.assertion, err)
+		}
+		failures := value.Check(test.data, test.found, context)
+		if len(failures) == 0 {
+			failures = nil
+		}
+		if !reflect.DeepEqual(failures, test.failures) {
+			t.Errorf("%v with %#v: expected %q, got %q", test.assertion, test.data, test.failures, failures)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package flow
+
+import (
+	"gograph/internal/template"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Evaluate the `if` condition of a step
+//
+// The condition is a template, `{{ eq .State.ROLE "admin" }}`, or a template
+// expression without the braces, `eq .State.ROLE "admin"`.
+func (step *FlowStep) condition(context *StepTemplateContext) (bool, error) {
+	text := step.If
+	if !strings.Contains(text, "{{") {
+		text = "{{ " + text + " }}"
+	}
+	value, err := template.RunTemplateValue(text, context)
+	if err != nil {
+		return false, err
+	}
+	return isTrue(value), nil
+}
+
+// The truth of a value: false, nil, zero, empty values and the strings
+// "false", "no", "0" and "<no value>" are false
+func isTrue(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	if s, ok := value.(string); ok {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch s {
+		case "", "false", "no", "<no value>":
+			return false
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n != 0
+		}
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() > 0
+	}
+	return !v.IsZero()
+}
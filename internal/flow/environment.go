@@ -0,0 +1,193 @@
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FlowEnvironment
+// ----------------------------------------
+//
+// The values of a target environment, selected with `flow run --env <name>`.
+//
+//	environments:
+//	  staging:
+//	    endpoints:
+//	      starwars: https://staging.example.com/graphql
+//	    headers:
+//	      X-Tenant: qa
+//	    state:
+//	      USER_ID: 42
+//	    vars:
+//	      readonly: true
+//
+// An environment can also be defined in the file `env/<name>.yml` next to the
+// flow, the values of the `environments` block override the ones of the file.
+type FlowEnvironment struct {
+	// Url of the endpoints by name
+	Endpoints map[string]string `yaml:",omitempty"`
+	// Headers added to the requests of all the steps
+	Headers map[string]interface{} `yaml:",omitempty"`
+	// Initial values of the state
+	State map[string]interface{} `yaml:",omitempty"`
+	// Values available in the templates with `.Env`
+	Vars map[string]interface{} `yaml:",omitempty"`
+}
+
+// A scalar of the yaml kept as it is written
+type rawScalar struct {
+	text string
+	ok   bool
+}
+
+func (r *rawScalar) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	r.ok = unmarshal(&r.text) == nil
+	return nil
+}
+
+// Read the values of the state with the rules of `--set`, see parseStateValue
+func (e *FlowEnvironment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowEnvironment
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	var raw struct {
+		State map[string]rawScalar
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	for key, value := range e.State {
+		switch value.(type) {
+		case int, int64, uint64, float64, bool:
+			if scalar := raw.State[key]; scalar.ok {
+				e.State[key] = parseStateValue(scalar.text)
+			}
+		}
+	}
+	return nil
+}
+
+// Merge the values of another environment, the values of the other one win
+func (e *FlowEnvironment) merge(other *FlowEnvironment) {
+	if other == nil {
+		return
+	}
+	for name, url := range other.Endpoints {
+		e.Endpoints[name] = url
+	}
+	for name, value := range other.Headers {
+		e.Headers[name] = value
+	}
+	for name, value := range other.State {
+		e.State[name] = value
+	}
+	for name, value := range other.Vars {
+		e.Vars[name] = value
+	}
+}
+
+// Load the environment of the file `env/<name>.yml`, nil if there is no file
+func (f *FlowDefinition) loadEnvironmentFile(name string) (*FlowEnvironment, error) {
+	for _, ext := range []string{".yml", ".yaml"} {
+		file := filepath.Join(f.BasePath, "env", name+ext)
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		env := &FlowEnvironment{}
+		if err := yaml.Unmarshal(data, env); err != nil {
+			return nil, fmt.Errorf("invalid environment file %v: %w", file, err)
+		}
+		return env, nil
+	}
+	return nil, nil
+}
+
+// Apply the values of an environment to the flow
+func (f *FlowDefinition) ApplyEnvironment(name string) error {
+	fromFile, err := f.loadEnvironmentFile(name)
+	if err != nil {
+		return err
+	}
+	inline := f.Environments[name]
+	if fromFile == nil && inline == nil {
+		return fmt.Errorf("[%v] unknown environment: %v", f.Name, name)
+	}
+
+	env := &FlowEnvironment{
+		Endpoints: make(map[string]string),
+		Headers:   make(map[string]interface{}),
+		State:     make(map[string]interface{}),
+		Vars:      make(map[string]interface{}),
+	}
+	env.merge(fromFile)
+	env.merge(inline)
+
+	for endpointName, url := range env.Endpoints {
+		found := false
+		for i := range f.Endpoints {
+			if f.Endpoints[i].Name == endpointName {
+				f.Endpoints[i].Url = url
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("[%v] environment %v: unknown endpoint %v", f.Name, name, endpointName)
+		}
+	}
+
+	if f.Headers == nil {
+		f.Headers = make(map[string]interface{})
+	}
+	for header, value := range env.Headers {
+		f.Headers[header] = value
+	}
+	for key, value := range env.State {
+		f.State[key] = value
+	}
+	f.Env = env.Vars
+	return nil
+}
+
+// Override values of the state, given as `KEY=VALUE`
+//
+// The values are parsed with parseStateValue so that `COUNT=3` is a number.
+func (f *FlowDefinition) SetState(values []string) error {
+	for _, value := range values {
+		key, raw, ok := strings.Cut(value, "=")
+		if !ok || len(key) == 0 {
+			return fmt.Errorf("invalid value %v, expected KEY=VALUE", value)
+		}
+		f.State[key] = parseStateValue(raw)
+	}
+	return nil
+}
+
+// Parse a value of the state given as text
+//
+// JSON values keep their type: numbers, true/false, null, quoted strings, arrays
+// and objects. Anything else is a string, yaml would read `0012` as an octal
+// number and `yes` as a boolean. A number is kept as a string when it isn't
+// written as it would be printed: `1.10` or an ID too large for a float.
+func parseStateValue(raw string) interface{} {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return raw
+	}
+	if number, ok := parsed.(float64); ok && strconv.FormatFloat(number, 'f', -1, 64) != raw {
+		return raw
+	}
+	return parsed
+}
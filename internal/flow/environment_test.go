@@ -0,0 +1,72 @@
+package flow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateValues(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected interface{}
+	}{
+		{"3", 3.0},
+		{"-1.5", -1.5},
+		{"true", true},
+		{"null", nil},
+		{`"42"`, "42"},
+		{`[1, "a"]`, []interface{}{1.0, "a"}},
+		{"0012", "0012"},
+		{"yes", "yes"},
+		{"1.10", "1.10"},
+		{"0x1F", "0x1F"},
+		{"12345678901234567890", "12345678901234567890"},
+		{"hello world", "hello world"},
+		{"", ""},
+	}
+
+	f := NewFlowDefinition("")
+	for _, test := range tests {
+		if err := f.SetState([]string{"KEY=" + test.raw}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f.State["KEY"], test.expected) {
+			t.Errorf("--set KEY=%v: expected %#v, got %#v", test.raw, test.expected, f.State["KEY"])
+		}
+	}
+}
+
+func TestEnvironmentStateValues(t *testing.T) {
+	f := LoadFlowDefinition([]byte(`
+environments:
+  qa:
+    state:
+      ID: 0012
+      FLAG: yes
+      VERSION: 1.10
+      HEX: 0x1F
+      COUNT: 3
+      ENABLED: true
+      QUOTED: "0012"
+      LIST: [1, 2]
+`), "")
+	if err := f.ApplyEnvironment("qa"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"ID":      "0012",
+		"FLAG":    "yes",
+		"VERSION": "1.10",
+		"HEX":     "0x1F",
+		"COUNT":   3.0,
+		"ENABLED": true,
+		"QUOTED":  "0012",
+		"LIST":    []interface{}{1, 2},
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(f.State[key], value) {
+			t.Errorf("%v: expected %#v, got %#v", key, value, f.State[key])
+		}
+	}
+}
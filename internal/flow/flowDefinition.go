@@ -1,12 +1,13 @@
 package flow
 
 import (
-	"bytes"
+	"fmt"
 	"gograph/internal/log"
-	"io"
-	"os"
-	"path/filepath"
-	"regexp"
+	"gograph/internal/secret"
+	"gograph/internal/template"
+	"gograph/internal/util"
+	"maps"
+	"slices"
 
 	"gopkg.in/yaml.v2"
 )
@@ -16,17 +17,63 @@ import (
 type FlowDefinition struct {
 	BasePath string
 
+	// Flow files merged into this one, see loadFlowDefinitionPart
+	Import []string `yaml:",omitempty"`
+
+	// The file the flow was loaded from
+	File string `yaml:"-"`
+
 	// The name of the flow
 	Name string `yaml:",omitempty"`
 
+	// Tags of the flow, they apply to all its steps
+	Tags []string `yaml:",flow,omitempty"`
+
+	// Seed for the random values generated by the templates
+	//   a random seed is used if not set, 0 is a valid seed
+	Seed *int64 `yaml:",omitempty"`
+
+	// Run the flow once for each combination of the values
+	Matrix map[string][]interface{} `yaml:",omitempty"`
+
+	// The values of the combination of the matrix being run
+	MatrixValues map[string]interface{} `yaml:"-"`
+
+	// The flow expanded into this combination of the matrix
+	source *FlowDefinition
+
+	// The random generators of the templates of the run, see FlowRunner.Run
+	random *template.Random
+
 	// Endpoint to query for the step
 	Endpoints []FlowEndpoint
 
+	// Target environments, selected with `flow run --env <name>`
+	Environments map[string]*FlowEnvironment `yaml:",omitempty"`
+
+	// Headers added to the requests of all the steps, the headers of a step win
+	Headers map[string]interface{} `yaml:",omitempty"`
+
+	// The values of the selected environment
+	Env map[string]interface{} `yaml:"-"`
+
 	// Values extracted from the steps
 	State map[string]interface{}
 
+	// Names of the values of the State holding secrets, they are masked in all the output
+	Secret []string `yaml:",flow,omitempty"`
+
+	// Steps shared by the steps of the flow and of the imported flows with `use: <name>`
+	StepTemplates map[string]FlowStep `yaml:"stepTemplates,omitempty"`
+
+	// Steps run before the steps, the steps are skipped if one of them fails
+	Setup []FlowStep `yaml:",omitempty"`
+
 	// Steps to process
 	Steps []FlowStep
+
+	// Steps run after the steps, even after a failure or an interrupt
+	Teardown []FlowStep `yaml:",omitempty"`
 }
 
 func (f *FlowDefinition) String() string {
@@ -38,8 +85,8 @@ func (f *FlowDefinition) String() string {
 }
 
 func (f *FlowDefinition) LoadEnpoints() error {
-	for _, endpoint := range f.Endpoints {
-		err := endpoint.LoadSchema(f.BasePath)
+	for i := range f.Endpoints {
+		err := f.Endpoints[i].LoadSchema(f.BasePath)
 		if err != nil {
 			log.Println("unable to load endpoint schema")
 			return err
@@ -48,78 +95,48 @@ func (f *FlowDefinition) LoadEnpoints() error {
 	return nil
 }
 
-func NewFlowDefinition(basePath string) *FlowDefinition {
-	f := &FlowDefinition{
-		BasePath: basePath,
-		State:    make(map[string]interface{}),
+// Register the values of the secret State names so that they are masked
+func (f *FlowDefinition) registerSecrets() {
+	for _, name := range f.Secret {
+		switch value := f.State[name].(type) {
+		case nil:
+		case string:
+			secret.Add(value)
+		default:
+			secret.Add(util.JsonPrint(value))
+		}
 	}
-	return f
 }
 
-type FlowDefImport struct {
-	Import []string `yaml:"import,omitempty"`
+// A copy of the flow with its own state, the endpoints and their schemas are shared
+func (f *FlowDefinition) Clone() *FlowDefinition {
+	clone := *f
+	clone.State = maps.Clone(f.State)
+	clone.Endpoints = slices.Clone(f.Endpoints)
+	clone.Headers = maps.Clone(f.Headers)
+	return &clone
 }
 
-func loadFlowDefinitionPart(file string) ([]byte, error) {
-
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, err
-	}
-
-	// The default yaml lib doesn't seem to be able to define custom tags
-	//  nor decode a file partially invalid (missing ref) so we use a dirty hack
-	// Load the file a first time to be able to read the imports
-	imports := FlowDefImport{}
-
-	// Extract only the import node
-	re := regexp.MustCompile(`(?m:import:\s*(\s*-.*\s*)*)`)
-	importChunk := re.Find(data)
-
-	// Parse the node
-	err = yaml.Unmarshal(importChunk, &imports)
-	if err != nil {
-		log.Println(imports)
-		return nil, err
-	}
-	// Read all the files and concatenate them
-	var b bytes.Buffer
-	writer := io.Writer(&b)
-	for _, importedFile := range imports.Import {
-
-		// Get a path relative to the file for the import
-		importedFilePath, _ := filepath.Abs(file)
-		importedFilePath = filepath.Dir(importedFilePath)
-		if filepath.IsAbs(importedFile) {
-			importedFilePath = importedFile
-		} else {
-			importedFilePath = filepath.Join(importedFilePath, importedFile)
-		}
-		imported, err := loadFlowDefinitionPart(importedFilePath)
-		if err != nil {
-			return nil, err
-		}
-
-		writer.Write([]byte("\n\n"))
-		writer.Write(imported)
+func NewFlowDefinition(basePath string) *FlowDefinition {
+	f := &FlowDefinition{
+		BasePath: basePath,
+		State:    make(map[string]interface{}),
 	}
-	writer.Write(data)
-
-	return b.Bytes(), nil
+	return f
 }
 
 func LoadFlowDefinitionFile(file string) (*FlowDefinition, error) {
 	log.Debugf("Loading flow definition file: %v", file)
 
-	b, err := loadFlowDefinitionPart(file)
+	flow, err := loadFlowDefinitionPart(file, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	basePath, _ := filepath.Abs(file)
-	basePath = filepath.Dir(basePath)
-
-	return LoadFlowDefinition(b, basePath), nil
+	if err := flow.useStepTemplates(); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	flow.File = file
+	return flow, nil
 }
 
 func LoadFlowDefinition(data []byte, basePath string) *FlowDefinition {
@@ -128,5 +145,8 @@ func LoadFlowDefinition(data []byte, basePath string) *FlowDefinition {
 	if err != nil {
 		log.Fatalln("Unable to load flow", err)
 	}
+	if err := t.useStepTemplates(); err != nil {
+		log.Fatalln("Unable to load flow", err)
+	}
 	return t
 }
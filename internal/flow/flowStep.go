@@ -2,11 +2,14 @@ package flow
 
 import (
 	"encoding/json"
+	"gograph/internal/log"
 	"gograph/internal/template"
 	"gograph/internal/util"
-	"regexp"
+	"maps"
+	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/PaesslerAG/jsonpath"
 )
@@ -14,6 +17,62 @@ import (
 type StepTemplateContext struct {
 	State map[string]interface{}
 	Step  *FlowStep
+
+	// The current item and its position when the step runs for each item of a list
+	Item  interface{}
+	Index int
+
+	// The values of the current combination of the flow matrix
+	Matrix map[string]interface{}
+
+	// The values of the selected environment
+	Env map[string]interface{}
+
+	logger *log.Logger
+	random *template.Random
+	dir    string
+}
+
+// The output of the templates goes to the logger of the step
+func (c *StepTemplateContext) TemplateLogger() *log.Logger {
+	return c.logger
+}
+
+// The random values of the templates only depend on the seed of the flow
+func (c *StepTemplateContext) TemplateRandom() *template.Random {
+	return c.random
+}
+
+// The files read by the templates are relative to the file defining the step
+func (c *StepTemplateContext) TemplateDir() string {
+	return c.dir
+}
+
+// The template context of a step of the flow
+func (f *FlowDefinition) templateContext(step *FlowStep, logger *log.Logger) *StepTemplateContext {
+	return &StepTemplateContext{
+		State:  f.State,
+		Step:   step,
+		Item:   step.item,
+		Index:  step.index,
+		Matrix: f.MatrixValues,
+		Env:    f.Env,
+		logger: logger,
+		random: f.random,
+		dir:    step.dir(f),
+	}
+}
+
+// The headers of the requests of a step, the headers of the step override the ones of the flow
+func (f *FlowDefinition) headers(step *FlowStep) map[string]interface{} {
+	if len(f.Headers) == 0 {
+		return step.Headers
+	}
+	headers := maps.Clone(f.Headers)
+	for name, value := range step.Headers {
+		headers[name] = value
+	}
+	return headers
 }
 
 // FlowStep
@@ -25,21 +84,124 @@ type FlowStep struct {
 	Queries  []string `yaml:",flow,omitempty"`
 	Depth    int      `yaml:",omitempty"`
 
+	// Name of the step template completing the step, see useStepTemplates
+	Use string `yaml:",omitempty"`
+
 	Input string `yaml:",omitempty"`
 
+	// Print the template values of the input as JSON, see template.RunJsonTemplate
+	JsonInput bool `yaml:"jsonInput,omitempty"`
+
+	// Structured query variables, the templates are run in each string value
+	Variables map[string]interface{} `yaml:",omitempty"`
+
 	Headers map[string]interface{}
 
+	// Tags to select the steps to run: `flow run --tags smoke`
+	Tags []string `yaml:",flow,omitempty"`
+
+	// Condition of the step, the step is skipped when it is false
+	If string `yaml:"if,omitempty"`
+
+	// Reason to skip the step, to disable it temporarily
+	Skip string `yaml:",omitempty"`
+
+	// Run the step even after a failure or an interrupt, for the cleanups
+	Always bool `yaml:",omitempty"`
+
+	// Steps run at the same time, each with a copy of the state
+	Parallel []FlowStep `yaml:",omitempty"`
+
+	// Run the step once for each item of a list
+	Foreach *FlowStepForeach `yaml:",omitempty"`
+
+	// Run the step again until the response matches
+	Retry *FlowStepRetry `yaml:",omitempty"`
+
 	Result struct {
 		Status            []int `yaml:",flow,omitempty"`
 		ExpectError       bool  `yaml:"error,omitempty"`
-		ContinueOnFailure bool  `yaml:"continueOnFailure,omitempty"`
-		Values            []struct {
-			Name  string `yaml:",omitempty"`
-			Path  string `yaml:",omitempty"`
-			Match string `yaml:",omitempty"`
-			Exact string `yaml:",omitempty"`
-		}
+		Errors            *FlowStepErrors
+		AllowPartial      bool `yaml:"allowPartial,omitempty"`
+		ContinueOnFailure bool `yaml:"continueOnFailure,omitempty"`
+		Values            []FlowStepValue
+		Headers           []FlowStepHeader
+		Cookies           []FlowStepCookie
+		JsonSchema        *FlowStepJsonSchema `yaml:"jsonSchema,omitempty"`
+		IgnoreSchema      bool                `yaml:"ignoreSchema,omitempty"`
+		MaxDuration       string              `yaml:"maxDuration,omitempty"`
+		Snapshot          string              `yaml:",omitempty"`
+		SnapshotIgnore    []string            `yaml:"snapshotIgnore,omitempty"`
+	}
+
+	// The item of the foreach iteration running the step
+	item  interface{}
+	index int
+
+	// The directory of the file defining the step
+	basePath string
+
+	// The yaml keys set on the step, `result.<key>` for the keys of the result
+	fields map[string]bool
+}
+
+// The directory of the file defining the step, the paths of the step are relative to it
+func (step *FlowStep) dir(flow *FlowDefinition) string {
+	if len(step.basePath) > 0 {
+		return step.basePath
 	}
+	return flow.BasePath
+}
+
+// A value extracted from a response header
+type FlowStepHeader struct {
+	// The name of the header
+	Header string `yaml:",omitempty"`
+	// The name under which the value is stored in the State
+	Name string `yaml:",omitempty"`
+
+	// Checks applied to the value
+	Assertion `yaml:",inline"`
+}
+
+// Keep the null expected values of the checks of the header
+func (h *FlowStepHeader) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowStepHeader
+	return unmarshalAssertion(unmarshal, (*plain)(h), &h.Assertion)
+}
+
+// A value extracted from a response cookie
+type FlowStepCookie struct {
+	// The name of the cookie
+	Cookie string `yaml:",omitempty"`
+	// The name under which the value is stored in the State
+	Name string `yaml:",omitempty"`
+
+	// Checks applied to the value
+	Assertion `yaml:",inline"`
+}
+
+// Keep the null expected values of the checks of the cookie
+func (c *FlowStepCookie) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowStepCookie
+	return unmarshalAssertion(unmarshal, (*plain)(c), &c.Assertion)
+}
+
+// A value extracted from the response with a json path
+type FlowStepValue struct {
+	// The name under which the value is stored in the State
+	Name string `yaml:",omitempty"`
+	// The json path of the value
+	Path string `yaml:",omitempty"`
+
+	// Checks applied to the value
+	Assertion `yaml:",inline"`
+}
+
+// Keep the null expected values of the checks of the value
+func (v *FlowStepValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowStepValue
+	return unmarshalAssertion(unmarshal, (*plain)(v), &v.Assertion)
 }
 
 func (e *FlowStep) EndpointParsed(context *StepTemplateContext) string {
@@ -51,8 +213,12 @@ func (e *FlowStep) NameParsed(context *StepTemplateContext) string {
 }
 
 func (e FlowStep) InputParsed(context *StepTemplateContext) (map[string]interface{}, error) {
-	// Extract the input to a map
-	parsedInput, err := template.RunTemplate(e.Input, context)
+	// Extract the input to a map, the values are printed as JSON with `jsonInput`
+	runTemplate := template.RunTemplate
+	if e.JsonInput {
+		runTemplate = template.RunJsonTemplate
+	}
+	parsedInput, err := runTemplate(e.Input, context)
 
 	if err != nil {
 		return nil, err
@@ -70,6 +236,21 @@ func (e FlowStep) InputParsed(context *StepTemplateContext) (map[string]interfac
 	return variables, nil
 }
 
+// Run the templates of the structured variables
+//
+// A value made of a single template expression keeps the type of the expression
+func (e FlowStep) VariablesParsed(context *StepTemplateContext) (map[string]interface{}, error) {
+	parsed, err := template.RunValueTemplates(e.Variables, context)
+	if err != nil {
+		return nil, err
+	}
+	variables, _ := parsed.(map[string]interface{})
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	return variables, nil
+}
+
 func (e *FlowStep) SelectEndpoint(options []FlowEndpoint, context *StepTemplateContext) *FlowEndpoint {
 	if len(options) == 0 {
 		return nil
@@ -89,16 +270,29 @@ func (e *FlowStep) SelectEndpoint(options []FlowEndpoint, context *StepTemplateC
 	return nil
 }
 
-func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
-
-	templateContext := &StepTemplateContext{
-		State: flow.State,
-		Step:  step,
+func (step *FlowStep) Run(flow *FlowDefinition, options *RunOption) *StepResult {
+	// The condition of a foreach step is checked for each item
+	if step.Foreach == nil && (len(step.Skip) > 0 || len(step.If) > 0) {
+		if result := step.skipped(flow, options); result != nil {
+			return result
+		}
+	}
+	if step.Foreach != nil {
+		return step.runForeach(flow, options)
+	}
+	if step.Retry != nil {
+		return step.runRetry(flow, options)
+	}
+	if len(step.Parallel) > 0 {
+		return step.runParallel(flow, options)
 	}
 
+	templateContext := flow.templateContext(step, options.Logger)
+
 	result := &StepResult{
-		Name:  step.NameParsed(templateContext),
-		State: make(map[string]interface{}),
+		Name:   step.NameParsed(templateContext),
+		State:  make(map[string]interface{}),
+		logger: options.Logger,
 	}
 
 	result.Verbosef("running")
@@ -128,11 +322,15 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 	result.Debugf("found %v queries", len(queries))
 
 	// Iterate over the queries
+	stepLogger := result.logger
 	for _, queryName := range queries {
+		// The output of the query is kept until the secrets of its response are registered
+		result.logger = stepLogger.Buffered()
+		templateContext.logger = result.logger
 
 		// Get the query input
 		var input map[string]interface{}
-		if len(step.Input) > 0 {
+		if len(step.Input) > 0 || len(step.Variables) > 0 {
 			// Input provided by user
 			v, err := step.InputParsed(templateContext)
 			if err != nil {
@@ -140,6 +338,15 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 				v = make(map[string]interface{})
 			}
 			input = v
+
+			// Structured variables override the input
+			variables, err := step.VariablesParsed(templateContext)
+			if err != nil {
+				result.Errorf("[%v] unable to parse query variables: %v", queryName, err)
+			}
+			for name, value := range variables {
+				input[name] = value
+			}
 		} else {
 			// Input not provided by user => generate
 			operation := endpoint.schema.FindOperationByName(queryName)
@@ -163,8 +370,11 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 			QueryName: queryName,
 			Depth:     step.Depth,
 			Variables: input,
-			Headers:   step.Headers,
+			Headers:   flow.headers(step),
 			context:   templateContext,
+			transport: options.Transport,
+			logger:    result.logger,
+			ctx:       options.context(),
 		}
 
 		result.Verbosef("[%v] executing query on %v", query.QueryName, query.Endpoint.Url)
@@ -175,6 +385,22 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 
 		result.Result = queryResult
 
+		// Check the duration of the query
+		// ----------------------------------------
+		if queryResult != nil && queryResult.Timing != nil {
+			result.Duration += queryResult.Timing.Total
+			result.Verbosef("[%v] timing: %v", query.QueryName, queryResult.Timing)
+
+			if len(step.Result.MaxDuration) > 0 {
+				maxDuration, err := time.ParseDuration(step.Result.MaxDuration)
+				if err != nil {
+					result.Errorf("[%v] invalid maxDuration: %v", query.QueryName, err)
+				} else if queryResult.Timing.Total > maxDuration {
+					result.Errorf("[%v] query took %v, more than maxDuration %v", query.QueryName, queryResult.Timing.Total.Round(time.Millisecond), maxDuration)
+				}
+			}
+		}
+
 		if queryResult != nil && queryResult.Reponse != nil {
 
 			// Check Status Code
@@ -195,30 +421,8 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 				result.Errorf("[%v] unable to parse response json", query.QueryName)
 			}
 
-			graphQlErrors := responseJson["errors"]
-
-			// The user expect a graphql error
-			if step.Result.ExpectError {
-				if graphQlErrors == nil {
-					result.Errorf("[%v] expected graphql error not found in response", query.QueryName)
-				}
-			} else {
-				// The user doesn't expect a graphql error
-				if graphQlErrors != nil {
-					switch graphQlErrors := graphQlErrors.(type) {
-					case []interface{}:
-						for _, gqlError := range graphQlErrors {
-							switch gqlError := gqlError.(type) {
-							case map[string]interface{}:
-								result.Errorf("[%v] GraphQL error: %v", query.QueryName, gqlError["message"])
-							default:
-								result.Errorf("[%v] unknown graphql error[] response format", query.QueryName)
-							}
-						}
-					default:
-						result.Errorf("[%v] unknown graphql error response format", query.QueryName)
-					}
-				}
+			for _, failure := range step.checkGraphqlErrors(responseJson) {
+				result.Errorf("[%v] %v", query.QueryName, failure)
 			}
 
 			// Process the responses
@@ -226,9 +430,13 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 			for _, value := range step.Result.Values {
 				// Extract the data
 				data, err := jsonpath.Get(value.Path, responseJson)
-				if err != nil {
+				found := err == nil
+				if !found && !value.absent() {
 					result.Errorf("[%v] unable to load jsonpath: %v, %v", query.QueryName, value.Path, err)
-				} else {
+					continue
+				}
+
+				if found {
 					result.Debugf("[%v] jsonpath %v=%v", query.QueryName, value.Path, util.PrettyPrint(data))
 					// Store the result if it is named
 					if len(value.Name) > 0 {
@@ -236,45 +444,122 @@ func (step *FlowStep) Run(flow *FlowDefinition) *StepResult {
 						flow.State[value.Name] = data
 						result.Debugf("[%v] stored [%v]=%v", query.QueryName, value.Name, util.PrettyPrint(data))
 					}
+				}
 
-					// Check if the result match a provided regexp
-					match := strings.TrimSpace(value.Match)
-					if len(match) > 0 {
-						result.Debugf("[%v] checking if data is a regex match %v=%v", query.QueryName, data, match)
-						// The type of the data MUST be string
-						var str string
-						if data == nil {
-							str = ""
-						}
-						switch t := data.(type) {
-						case string:
-							str = t
-						default:
-							// convert it back to JSON to get a value
-							str = util.JsonPrint(data)
-						}
-						re, err := regexp.Compile(match)
-						if err != nil {
-							result.Errorf("[%v] invalid regexp: %v, %v, %v", query.QueryName, value.Path, match, err)
-						}
-						if !re.MatchString(str) {
-							result.Errorf("[%v] Value doesn't match expected format: %v=%v, %v", query.QueryName, value.Path, str, match)
-						}
-					}
+				// Check the assertions
+				for _, failure := range value.Check(data, found, templateContext) {
+					result.Errorf("[%v] %v: %v", query.QueryName, value.Path, failure)
+				}
+			}
 
-					// Check if the value is an exact match
-					exact := strings.TrimSpace(value.Exact)
-					if len(exact) > 0 {
-						exact = template.RunTemplateOrUnparsed(exact, templateContext)
-						result.Debugf("[%v] checking if data is an exact match %v=%v", query.QueryName, data, exact)
-						if data != exact {
-							result.Errorf("[%v] value error: [%v](%v) != (%v)", query.QueryName, value.Path, data, exact)
-						}
-					}
+			// Process the headers
+			// ----------------------------------------
+			for _, header := range step.Result.Headers {
+				values := queryResult.Reponse.Header.Values(header.Header)
+				found := len(values) > 0
+				data := strings.Join(values, ", ")
+
+				if found && len(header.Name) > 0 {
+					result.State[header.Name] = data
+					flow.State[header.Name] = data
+					result.Debugf("[%v] stored [%v]=%v", query.QueryName, header.Name, data)
+				}
+
+				for _, failure := range header.Check(data, found, templateContext) {
+					result.Errorf("[%v] header %v: %v", query.QueryName, header.Header, failure)
+				}
+			}
+
+			// Process the cookies
+			// ----------------------------------------
+			for _, cookie := range step.Result.Cookies {
+				idx := slices.IndexFunc(queryResult.Reponse.Cookies, func(c *http.Cookie) bool { return c.Name == cookie.Cookie })
+				found := idx >= 0
+				var data string
+				if found {
+					data = queryResult.Reponse.Cookies[idx].Value
+				}
+
+				if found && len(cookie.Name) > 0 {
+					result.State[cookie.Name] = data
+					flow.State[cookie.Name] = data
+					result.Debugf("[%v] stored [%v]=%v", query.QueryName, cookie.Name, data)
+				}
+
+				for _, failure := range cookie.Check(data, found, templateContext) {
+					result.Errorf("[%v] cookie %v: %v", query.QueryName, cookie.Cookie, failure)
+				}
+			}
+
+			flow.registerSecrets()
+
+			// Validate the response against the graphql schema
+			// ----------------------------------------
+			if !step.Result.IgnoreSchema && queryResult.Request != nil && responseJson["data"] != nil {
+				for _, err := range endpoint.schema.ValidateResponse(queryResult.Request.Body.Query, responseJson["data"]) {
+					result.Errorf("[%v] schema violation at %v", query.QueryName, err)
+				}
+			}
+
+			// Compare the response with the snapshot
+			// ----------------------------------------
+			if len(step.Result.Snapshot) > 0 {
+				name := template.RunTemplateOrUnparsed(step.Result.Snapshot, templateContext)
+				if len(queries) > 1 {
+					name = name + "-" + queryName
+				}
+				file := flow.snapshotPath(step.dir(flow), name)
+				written, diff, err := flow.CheckSnapshot(file, step.Result.SnapshotIgnore, responseJson, options.UpdateSnapshots)
+				if err != nil {
+					result.Errorf("[%v] snapshot %v failed: %v", query.QueryName, name, err)
+				} else if written {
+					result.Printf("[%v] snapshot written: %v", query.QueryName, file)
+				} else if len(diff) > 0 {
+					result.Errorf("[%v] response doesn't match snapshot %v:\n      %v", query.QueryName, name, strings.Join(diff, "\n      "))
+				}
+			}
+
+			// Validate the response against a JSON schema
+			// ----------------------------------------
+			if step.Result.JsonSchema != nil {
+				for _, err := range step.Result.JsonSchema.Validate(responseJson, step.dir(flow)) {
+					result.Errorf("[%v] %v", query.QueryName, err)
 				}
 			}
 		}
+
+		result.logger.Flush()
+		result.logger = stepLogger
+		templateContext.logger = stepLogger
 		// range queries
 	}
 	return result
 }
+
+// The result of the step if it is skipped, nil if it must run
+func (step *FlowStep) skipped(flow *FlowDefinition, options *RunOption) *StepResult {
+	templateContext := flow.templateContext(step, options.Logger)
+	result := &StepResult{
+		Name:   step.NameParsed(templateContext),
+		State:  make(map[string]interface{}),
+		logger: options.Logger,
+	}
+
+	if len(step.Skip) > 0 {
+		result.Skipped = template.RunTemplateOrUnparsed(step.Skip, templateContext)
+		result.Printf("skipped: %v", result.Skipped)
+		return result
+	}
+
+	run, err := step.condition(templateContext)
+	if err != nil {
+		result.Errorf("invalid condition %v: %v", step.If, err)
+		return result
+	}
+	if !run {
+		result.Skipped = "condition is false: " + step.If
+		result.Verbosef("skipped, %v", result.Skipped)
+		return result
+	}
+	return nil
+}
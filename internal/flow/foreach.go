@@ -0,0 +1,165 @@
+package flow
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gograph/internal/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+	"gopkg.in/yaml.v2"
+)
+
+// FlowStepForeach
+// ----------------------------------------
+//
+// The items the step is run for, `.Item` and `.Index` give the current item in the templates.
+//
+//	foreach:
+//	  items: [1, 2, 3]          # an inline list
+//	  path: $.FILMS             # a json path in the state
+//	  dataFile: films.csv       # a csv, json or yaml file relative to the flow
+//	  name: "film {{ .Item.id }}"
+//
+// The inline list or the json path can be given directly as a shorthand. The
+// `if` and `skip` of the step are checked for each item.
+type FlowStepForeach struct {
+	// Inline list of items, the templates are run in each string value
+	Items []interface{} `yaml:",omitempty"`
+	// Json path of a list in the state
+	Path string `yaml:",omitempty"`
+	// File with the list of items: csv with a header line, json or yaml
+	DataFile string `yaml:"dataFile,omitempty"`
+	// Template of the name of each run, `<step>[<index>]` by default
+	Name string `yaml:",omitempty"`
+}
+
+// Accept the list of items or the json path as a shorthand
+func (f *FlowStepForeach) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []interface{}
+	if err := unmarshal(&items); err == nil {
+		f.Items = items
+		return nil
+	}
+	var path string
+	if err := unmarshal(&path); err == nil {
+		f.Path = path
+		return nil
+	}
+	type plain FlowStepForeach
+	return unmarshal((*plain)(f))
+}
+
+// Load the items of a data file
+func loadDataFile(file string) ([]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		// Each line is an object with the columns of the header line
+		for i, record := range records {
+			if i == 0 {
+				continue
+			}
+			item := make(map[string]interface{}, len(record))
+			for j, value := range record {
+				if j < len(records[0]) {
+					item[records[0][j]] = value
+				}
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case ".json":
+		err = json.Unmarshal(data, &items)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &items)
+	default:
+		return nil, fmt.Errorf("unknown data file format: %v", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return yamlToJson(items).([]interface{}), nil
+}
+
+// The list of items to run the step for
+func (f *FlowStepForeach) items(flow *FlowDefinition, basePath string, context *StepTemplateContext) ([]interface{}, error) {
+	switch {
+	case len(f.DataFile) > 0:
+		file := template.RunTemplateOrUnparsed(f.DataFile, context)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(basePath, file)
+		}
+		return loadDataFile(file)
+
+	case len(f.Path) > 0:
+		data, err := jsonpath.Get(f.Path, flow.State)
+		if err != nil {
+			return nil, err
+		}
+		if items, ok := yamlToJson(data).([]interface{}); ok {
+			return items, nil
+		}
+		return []interface{}{data}, nil
+
+	default:
+		items, err := template.RunValueTemplates(yamlToJson(f.Items), context)
+		if err != nil {
+			return nil, err
+		}
+		list, _ := items.([]interface{})
+		return list, nil
+	}
+}
+
+// Run the step once for each item, each run is a child of the result
+func (step *FlowStep) runForeach(flow *FlowDefinition, options *RunOption) *StepResult {
+	templateContext := flow.templateContext(step, options.Logger)
+
+	result := &StepResult{
+		Name:     step.NameParsed(templateContext),
+		State:    make(map[string]interface{}),
+		Children: []*StepResult{},
+		logger:   options.Logger,
+	}
+
+	items, err := step.Foreach.items(flow, step.dir(flow), templateContext)
+	if err != nil {
+		result.Errorf("unable to load the foreach items: %v", err)
+		return result
+	}
+	result.Verbosef("running for %v items", len(items))
+
+	for i, item := range items {
+		iteration := *step
+		iteration.Foreach = nil
+		iteration.item = item
+		iteration.index = i
+
+		iteration.Name = fmt.Sprintf("%v[%v]", result.Name, i)
+		if len(step.Foreach.Name) > 0 {
+			iteration.Name = template.RunTemplateOrUnparsed(step.Foreach.Name, flow.templateContext(&iteration, options.Logger))
+		}
+
+		child := iteration.Run(flow, options)
+
+		for name, value := range child.State {
+			result.State[name] = value
+		}
+		result.Duration += child.Duration
+		result.Children = append(result.Children, child)
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"testing"
+)
+
+func TestForeachConditionPerItem(t *testing.T) {
+	f := LoadFlowDefinition([]byte(`
+steps:
+  - name: each
+    query: film
+    if: "{{ .Item.enabled }}"
+    foreach:
+      - enabled: false
+      - enabled: false
+`), "")
+
+	result := f.Steps[0].Run(f, &RunOption{Logger: log.Discard})
+	if result.HasError() {
+		t.Fatalf("expected no error, got %v", result.Errors)
+	}
+	if len(result.Children) != 2 {
+		t.Fatalf("expected 2 iterations, got %v", len(result.Children))
+	}
+	for _, child := range result.Children {
+		if !child.IsSkipped() {
+			t.Errorf("%v: expected the disabled item to be skipped", child.Name)
+		}
+	}
+}
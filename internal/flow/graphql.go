@@ -2,13 +2,20 @@ package flow
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"gograph/internal/log"
 	"gograph/internal/schema"
+	"gograph/internal/secret"
 	"gograph/internal/template"
 	"gograph/internal/util"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"time"
 )
 
 var DEBUG bool = true
@@ -26,6 +33,9 @@ type GraphqlRequest struct {
 	Variables map[string]interface{} `json:"variables"`
 	Headers   map[string]interface{} `json:"headers"`
 	context   *StepTemplateContext
+	transport http.RoundTripper
+	logger    *log.Logger
+	ctx       context.Context
 }
 
 func (g *GraphqlRequest) GenerateQuery(options *schema.QuerySelectorOptions) *schema.QueryString {
@@ -41,10 +51,61 @@ func (g *GraphqlRequest) GenerateQuery(options *schema.QuerySelectorOptions) *sc
 type GraphqlRunResult struct {
 	Request *GraphqlRunResult_Request  `json:"request"`
 	Reponse *GraphqlRunResult_Response `json:"response"`
+	Timing  *GraphqlRunResult_Timing   `json:"timing"`
+}
+
+// Durations of the phases of the request
+//
+// DNS, Connect and TLS are zero when the connection is reused. Queue is the
+// time waiting for a rate limit before the request, it is not part of Total.
+type GraphqlRunResult_Timing struct {
+	Queue   time.Duration `json:"queue,omitempty"`
+	DNS     time.Duration `json:"dns"`
+	Connect time.Duration `json:"connect"`
+	TLS     time.Duration `json:"tls"`
+	// Time to first byte of the response, from the start of the request
+	TTFB  time.Duration `json:"ttfb"`
+	Total time.Duration `json:"total"`
+}
+
+func (t *GraphqlRunResult_Timing) String() string {
+	timing := fmt.Sprintf("dns: %v, connect: %v, tls: %v, ttfb: %v, total: %v",
+		t.DNS.Round(time.Microsecond),
+		t.Connect.Round(time.Microsecond),
+		t.TLS.Round(time.Microsecond),
+		t.TTFB.Round(time.Microsecond),
+		t.Total.Round(time.Microsecond))
+	if t.Queue > 0 {
+		timing = fmt.Sprintf("queue: %v, %v", t.Queue.Round(time.Microsecond), timing)
+	}
+	return timing
+}
+
+// Create a trace recording the timing of a request
+func newTimingTrace(timing *GraphqlRunResult_Timing, start time.Time) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart time.Time
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { timing.DNS = time.Since(dnsStart) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { timing.Connect = time.Since(connectStart) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timing.TLS = time.Since(tlsStart) },
+		GotFirstResponseByte: func() { timing.TTFB = time.Since(start) },
+	}
+}
+
+// A transport limiting the rate of the requests, the requests wait for the limit
+// before their timing starts
+type RateLimiter interface {
+	http.RoundTripper
+	Wait(ctx context.Context) error
 }
 
 type GraphqlRunResult_Request struct {
-	Body *GraphqlRequestBody `json:"body"`
+	Url    string              `json:"url"`
+	Header http.Header         `json:"header"`
+	Body   *GraphqlRequestBody `json:"body"`
 }
 
 type GraphqlRunResult_Response struct {
@@ -101,8 +162,12 @@ func (g *GraphqlRequest) Run() (*GraphqlRunResult, error) {
 	url := g.Endpoint.UrlParsed(g.context)
 
 	// Create a new HTTP request
-	log.Verboseln("GraphqlRequest: calling", url)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	g.logger.Verboseln("GraphqlRequest: calling", url)
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return result, err
 	}
@@ -111,7 +176,15 @@ func (g *GraphqlRequest) Run() (*GraphqlRunResult, error) {
 	req.Header.Set("Content-Type", "application/json")
 	if g.Headers != nil {
 
-		for name, value := range g.Headers {
+		// In sorted order so that the random values only depend on the seed
+		names := make([]string, 0, len(g.Headers))
+		for name := range g.Headers {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			value := g.Headers[name]
 
 			// convert the value to string
 			var v string
@@ -121,22 +194,38 @@ func (g *GraphqlRequest) Run() (*GraphqlRunResult, error) {
 			default:
 				v = util.JsonPrint(t)
 			}
-			v = template.RunTemplateOrUnparsed(v, g.context)
-			log.Debugf("Setting header: %v=%v", name, v)
+			v = template.RunHeaderTemplate(name, v, g.context)
+			g.logger.Debugf("Setting header: %v=%v", name, v)
 			req.Header.Set(name, v)
 		}
 	}
-	// Set request headers
+	result.Request.Url = url
+	result.Request.Header = req.Header
 
 	// Add your authorization token here if needed
 	// req.Header.Set("Authorization", "Bearer YOUR_ACCESS_TOKEN")
 
-	// Initialize HTTP client
-	client := &http.Client{}
+	// Initialize HTTP client, the default transport is used when not set
+	client := &http.Client{Transport: g.transport}
+
+	// Wait for the rate limit of the transport before the timing starts
+	result.Timing = &GraphqlRunResult_Timing{}
+	if limiter, ok := g.transport.(RateLimiter); ok {
+		queued := time.Now()
+		if err := limiter.Wait(req.Context()); err != nil {
+			return result, err
+		}
+		result.Timing.Queue = time.Since(queued)
+	}
+
+	// Trace the timing of the request
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), newTimingTrace(result.Timing, start)))
 
 	// Send the request
 	resp, err := client.Do(req)
 	if err != nil {
+		result.Timing.Total = time.Since(start)
 		return result, err
 	}
 	defer resp.Body.Close()
@@ -147,11 +236,15 @@ func (g *GraphqlRequest) Run() (*GraphqlRunResult, error) {
 		Header:     resp.Header,
 		Cookies:    resp.Cookies(),
 	}
+	for _, cookie := range result.Reponse.Cookies {
+		secret.Add(cookie.Value)
+	}
 
 	// resp.Header
 
 	// Get the response text
 	responseBody, err := io.ReadAll(resp.Body)
+	result.Timing.Total = time.Since(start)
 	if err != nil {
 		return result, err
 	}
@@ -161,28 +254,29 @@ func (g *GraphqlRequest) Run() (*GraphqlRunResult, error) {
 	result.Reponse.Body = responseBody
 
 	if DEBUG {
-		log.Verbose("GraphqlRequest: query")
-		log.Verbose(" Header          :")
+		g.logger.Verbose("GraphqlRequest: query")
+		g.logger.Verbose(" Header          :")
 		// TODO
-		log.Verbose(" Body           :")
-		log.Verbose(string(requestBody))
-		log.Debug(" Query          :")
-		log.Debug(query.Text)
-
-		log.Verbose("GraphqlRequest: result")
-		log.Verbose(" Status          :", result.Reponse.Status)
-		log.Verbose(" Code            :", result.Reponse.StatusCode)
-		log.Verbose(" ContentLength   :", result.Reponse.ContentLength)
-		log.Verbosef(" Header          : %v", len(result.Reponse.Header))
+		g.logger.Verbose(" Body           :")
+		g.logger.Verbose(string(requestBody))
+		g.logger.Debug(" Query          :")
+		g.logger.Debug(query.Text)
+
+		g.logger.Verbose("GraphqlRequest: result")
+		g.logger.Verbose(" Status          :", result.Reponse.Status)
+		g.logger.Verbose(" Code            :", result.Reponse.StatusCode)
+		g.logger.Verbose(" ContentLength   :", result.Reponse.ContentLength)
+		g.logger.Verbosef(" Header          : %v", len(result.Reponse.Header))
 		for k, header := range result.Reponse.Header {
-			log.Verbosef("  %v: %v ", k, header)
+			g.logger.Verbosef("  %v: %v ", k, header)
 		}
-		log.Verbosef(" Cookies         : %v", len(result.Reponse.Cookies))
+		g.logger.Verbosef(" Cookies         : %v", len(result.Reponse.Cookies))
 		for i, cookie := range result.Reponse.Cookies {
-			log.Verbosef("  %v: %v ", i, cookie.Raw)
+			g.logger.Verbosef("  %v: %v ", i, cookie.Raw)
 		}
-		log.Verbosef(" Body            : %v", len(result.Reponse.Body))
-		log.Verbosef(string(result.Reponse.Body))
+		g.logger.Verbosef(" Timing          : %v", result.Timing)
+		g.logger.Verbosef(" Body            : %v", len(result.Reponse.Body))
+		g.logger.Verbosef(string(result.Reponse.Body))
 	}
 
 	return result, nil
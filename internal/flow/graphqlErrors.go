@@ -0,0 +1,242 @@
+package flow
+
+import (
+	"fmt"
+	"gograph/internal/util"
+	"regexp"
+	"strings"
+)
+
+// FlowStepErrors
+// ----------------------------------------
+//
+// The graphql errors expected in the response.
+//
+//	errors:
+//	  count: 1
+//	  expected:
+//	    - match: ^No valid ID
+//	      code: BAD_USER_INPUT
+//	      path: film
+//
+// The list of expected errors can be given directly as a shorthand.
+type FlowStepErrors struct {
+	// The exact number of errors
+	Count *int `yaml:",omitempty"`
+	// Each expected error must match an error of the response
+	Expected []FlowStepError `yaml:",omitempty"`
+}
+
+// An expected graphql error
+type FlowStepError struct {
+	// Exact message
+	Message string `yaml:",omitempty"`
+	// Regexp on the message
+	Match string `yaml:",omitempty"`
+	// The `extensions.code` of the error
+	Code string `yaml:",omitempty"`
+	// The path of the error, joined with dots: allFilms.films.0.title
+	Path string `yaml:",omitempty"`
+
+	// The compiled `match`, or the error of an invalid regexp
+	match      *regexp.Regexp
+	matchError error
+}
+
+// Accept the list of expected errors as a shorthand
+func (e *FlowStepErrors) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var expected []FlowStepError
+	if err := unmarshal(&expected); err == nil {
+		e.Expected = expected
+		return nil
+	}
+	type plain FlowStepErrors
+	return unmarshal((*plain)(e))
+}
+
+// Compile the regexp when the step is loaded
+func (e *FlowStepError) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowStepError
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	e.compile()
+	return nil
+}
+
+// Compile the `match` regexp once, an invalid regexp is reported by the step
+func (e *FlowStepError) compile() error {
+	if len(e.Match) > 0 && e.match == nil && e.matchError == nil {
+		e.match, e.matchError = regexp.Compile(e.Match)
+	}
+	return e.matchError
+}
+
+// A graphql error from a response
+type graphqlError struct {
+	Message    string
+	Path       string
+	Extensions map[string]interface{}
+}
+
+func (e *graphqlError) String() string {
+	var out strings.Builder
+	out.WriteString(e.Message)
+	if len(e.Path) > 0 {
+		out.WriteString(fmt.Sprintf(" (path: %v)", e.Path))
+	}
+	if len(e.Extensions) > 0 {
+		out.WriteString(fmt.Sprintf(" (extensions: %v)", util.JsonPrint(e.Extensions)))
+	}
+	return out.String()
+}
+
+// Extract the graphql errors from a response
+func parseGraphqlErrors(errors interface{}) ([]*graphqlError, error) {
+	if errors == nil {
+		return nil, nil
+	}
+	list, ok := errors.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown graphql error response format")
+	}
+	result := []*graphqlError{}
+	for _, item := range list {
+		gqlError, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unknown graphql error[] response format")
+		}
+		e := &graphqlError{}
+		e.Message, _ = gqlError["message"].(string)
+		e.Extensions, _ = gqlError["extensions"].(map[string]interface{})
+		if path, ok := gqlError["path"].([]interface{}); ok {
+			parts := make([]string, len(path))
+			for i, p := range path {
+				parts[i] = fmt.Sprint(p)
+			}
+			e.Path = strings.Join(parts, ".")
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// Check if an error of the response matches the expected error
+func (expected *FlowStepError) Matches(e *graphqlError) bool {
+	if len(expected.Message) > 0 && expected.Message != e.Message {
+		return false
+	}
+	if len(expected.Match) > 0 {
+		if expected.compile() != nil || !expected.match.MatchString(e.Message) {
+			return false
+		}
+	}
+	if len(expected.Code) > 0 && fmt.Sprint(e.Extensions["code"]) != expected.Code {
+		return false
+	}
+	if len(expected.Path) > 0 && expected.Path != e.Path {
+		return false
+	}
+	return true
+}
+
+func (expected *FlowStepError) String() string {
+	parts := []string{}
+	if len(expected.Message) > 0 {
+		parts = append(parts, fmt.Sprintf("message: %v", expected.Message))
+	}
+	if len(expected.Match) > 0 {
+		parts = append(parts, fmt.Sprintf("match: %v", expected.Match))
+	}
+	if len(expected.Code) > 0 {
+		parts = append(parts, fmt.Sprintf("code: %v", expected.Code))
+	}
+	if len(expected.Path) > 0 {
+		parts = append(parts, fmt.Sprintf("path: %v", expected.Path))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Check the graphql errors of a response against the expectations of the step
+func (step *FlowStep) checkGraphqlErrors(responseJson map[string]interface{}) []string {
+	failures := []string{}
+
+	gqlErrors, err := parseGraphqlErrors(responseJson["errors"])
+	if err != nil {
+		return append(failures, err.Error())
+	}
+
+	expectedErrors := step.Result.Errors
+
+	// No error expected
+	if !step.Result.ExpectError && expectedErrors == nil {
+		for _, e := range gqlErrors {
+			failures = append(failures, fmt.Sprintf("GraphQL error: %v", e))
+		}
+		return failures
+	}
+
+	if step.Result.ExpectError && len(gqlErrors) == 0 {
+		failures = append(failures, "expected graphql error not found in response")
+	}
+
+	if expectedErrors == nil {
+		return failures
+	}
+
+	if expectedErrors.Count != nil {
+		if len(gqlErrors) != *expectedErrors.Count {
+			failures = append(failures, fmt.Sprintf("expected %v graphql errors, got %v", *expectedErrors.Count, len(gqlErrors)))
+		}
+	} else if len(gqlErrors) == 0 {
+		failures = append(failures, "expected graphql error not found in response")
+	}
+
+	// Each expected error must be in the response
+	matched := make([]bool, len(gqlErrors))
+	for i := range expectedErrors.Expected {
+		expected := &expectedErrors.Expected[i]
+		if err := expected.compile(); err != nil {
+			failures = append(failures, fmt.Sprintf("invalid match regexp %v: %v", expected.Match, err))
+			continue
+		}
+		found := false
+		for i, e := range gqlErrors {
+			if expected.Matches(e) {
+				matched[i] = true
+				found = true
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("expected graphql error not found: %v", expected.String()))
+		}
+	}
+
+	// The errors of the response must all be expected
+	if len(expectedErrors.Expected) > 0 {
+		for i, e := range gqlErrors {
+			if !matched[i] {
+				failures = append(failures, fmt.Sprintf("unexpected GraphQL error: %v", e))
+			}
+		}
+	}
+
+	// Errors with data is a partial response
+	if len(gqlErrors) > 0 && responseJson["data"] != nil && !step.Result.AllowPartial {
+		if data, ok := responseJson["data"].(map[string]interface{}); !ok || hasNonNullValue(data) {
+			failures = append(failures, "partial response: data returned with the errors, use allowPartial to accept it")
+		}
+	}
+
+	return failures
+}
+
+// Check if one of the root fields is not null
+func hasNonNullValue(data map[string]interface{}) bool {
+	for _, v := range data {
+		if v != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpectedErrorMatch(t *testing.T) {
+	f := LoadFlowDefinition([]byte(`
+steps:
+  - name: valid
+    query: film
+    result:
+      errors:
+        - match: ^No valid ID
+  - name: invalid
+    query: film
+    result:
+      errors:
+        - match: ^No valid (ID
+`), "")
+
+	response := map[string]interface{}{
+		"errors": []interface{}{
+			map[string]interface{}{"message": "No valid ID extracted from"},
+		},
+	}
+
+	if failures := f.Steps[0].checkGraphqlErrors(response); len(failures) > 0 {
+		t.Errorf("expected the error to match, got %v", failures)
+	}
+
+	failures := f.Steps[1].checkGraphqlErrors(response)
+	if len(failures) == 0 || !strings.HasPrefix(failures[0], "invalid match regexp ^No valid (ID") {
+		t.Errorf("expected the invalid regexp to be reported, got %v", failures)
+	}
+}
@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"fmt"
+	"gograph/internal/log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Imports
+// ----------------------------------------
+//
+// A flow file can import other flow files to share endpoints, state, step
+// templates and steps:
+//
+//	import:
+//	  - common/endpoints.yml
+//	  - common/login.yml
+//
+// Each file is parsed on its own, the yaml anchors are local to a file. The
+// paths are relative to the importing file. The imports are merged in order,
+// then the importing file is merged over them:
+//   - the endpoints, the step templates, the environments, the headers and the
+//     matrix are merged by name, the importing file wins
+//   - the state values are merged, the importing file wins
+//   - the setup and the steps of the imports run before the ones of the file,
+//     their teardown runs after the one of the file
+//   - the tags and the secrets are merged
+//   - the name and the seed of the importing file are kept when they are set
+//
+// The paths are relative to the file defining them: the schemas of the
+// endpoints, the snapshots, the data files and the json schemas of the steps.
+
+// Load a flow file and merge its imports
+//
+// The stack lists the files being imported to detect the cycles.
+func loadFlowDefinitionPart(file string, stack []string) (*FlowDefinition, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	if idx := slices.Index(stack, absFile); idx >= 0 {
+		cycle := append(slices.Clone(stack[idx:]), absFile)
+		return nil, fmt.Errorf("import cycle: %v", strings.Join(cycle, " -> "))
+	}
+	stack = append(stack, absFile)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	part := NewFlowDefinition(filepath.Dir(absFile))
+	if err := yaml.Unmarshal(data, part); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+	part.setStepsBasePath()
+
+	// Merge the imports in order, each one over the previous ones
+	var imported *FlowDefinition
+	for _, importedFile := range part.Import {
+		if !filepath.IsAbs(importedFile) {
+			importedFile = filepath.Join(part.BasePath, importedFile)
+		}
+		log.Debugf("Importing flow definition file: %v", importedFile)
+
+		importedPart, err := loadFlowDefinitionPart(importedFile, stack)
+		if err != nil {
+			return nil, err
+		}
+		importedPart.absoluteSchemas()
+		if imported == nil {
+			imported = importedPart
+		} else {
+			imported = importedPart.mergeOver(imported)
+		}
+	}
+	if imported == nil {
+		return part, nil
+	}
+	return part.mergeOver(imported), nil
+}
+
+// Resolve the schemas of the endpoints relatively to the file defining them
+func (f *FlowDefinition) absoluteSchemas() {
+	for i := range f.Endpoints {
+		schemaFile := f.Endpoints[i].SchemaFile
+		if len(schemaFile) > 0 && !filepath.IsAbs(schemaFile) {
+			f.Endpoints[i].SchemaFile = filepath.Join(f.BasePath, schemaFile)
+		}
+	}
+}
+
+// Keep the directory of the file defining the steps, their paths are relative to it
+func (f *FlowDefinition) setStepsBasePath() {
+	var set func(steps []FlowStep)
+	set = func(steps []FlowStep) {
+		for i := range steps {
+			steps[i].basePath = f.BasePath
+			set(steps[i].Parallel)
+		}
+	}
+	set(f.Setup)
+	set(f.Steps)
+	set(f.Teardown)
+
+	// The fields of a template are copied to steps of other files
+	for name, template := range f.StepTemplates {
+		template.basePath = f.BasePath
+		set(template.Parallel)
+		if template.Result.JsonSchema != nil && len(template.Result.JsonSchema.File) > 0 && !filepath.IsAbs(template.Result.JsonSchema.File) {
+			jsonSchema := *template.Result.JsonSchema
+			jsonSchema.File = filepath.Join(f.BasePath, jsonSchema.File)
+			template.Result.JsonSchema = &jsonSchema
+		}
+		// A data file made of a template is relative to the file of the step using the template
+		if template.Foreach != nil && len(template.Foreach.DataFile) > 0 && !filepath.IsAbs(template.Foreach.DataFile) && !strings.Contains(template.Foreach.DataFile, "{{") {
+			foreach := *template.Foreach
+			foreach.DataFile = filepath.Join(f.BasePath, foreach.DataFile)
+			template.Foreach = &foreach
+		}
+		f.StepTemplates[name] = template
+	}
+}
+
+// Merge a flow over a base flow, the values of the flow win
+func (f *FlowDefinition) mergeOver(base *FlowDefinition) *FlowDefinition {
+	merged := *f
+
+	if len(merged.Name) == 0 {
+		merged.Name = base.Name
+	}
+	if merged.Seed == nil {
+		merged.Seed = base.Seed
+	}
+	merged.Tags = mergeNames(base.Tags, f.Tags)
+	merged.Secret = mergeNames(base.Secret, f.Secret)
+
+	// The endpoints of the flow first, the first one is the default endpoint
+	merged.Endpoints = slices.Clone(f.Endpoints)
+	for _, endpoint := range base.Endpoints {
+		if !slices.ContainsFunc(merged.Endpoints, func(e FlowEndpoint) bool { return e.Name == endpoint.Name }) {
+			merged.Endpoints = append(merged.Endpoints, endpoint)
+		}
+	}
+
+	merged.State = mergeMaps(base.State, f.State)
+	merged.Headers = mergeMaps(base.Headers, f.Headers)
+	merged.Matrix = mergeMaps(base.Matrix, f.Matrix)
+	merged.Environments = mergeMaps(base.Environments, f.Environments)
+	merged.StepTemplates = mergeMaps(base.StepTemplates, f.StepTemplates)
+
+	merged.Setup = append(slices.Clone(base.Setup), f.Setup...)
+	merged.Steps = append(slices.Clone(base.Steps), f.Steps...)
+	merged.Teardown = append(slices.Clone(f.Teardown), base.Teardown...)
+	return &merged
+}
+
+// Merge two maps, the values of the second one win
+func mergeMaps[V any](base, over map[string]V) map[string]V {
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]V)
+	}
+	for key, value := range over {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Merge two lists of names without duplicates
+func mergeNames(base, over []string) []string {
+	merged := slices.Clone(base)
+	for _, name := range over {
+		if !slices.Contains(merged, name) {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,164 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// FlowStepJsonSchema
+// ----------------------------------------
+//
+// Validate the response, or a sub-tree of the response, against a JSON schema.
+//
+//	jsonSchema: schemas/film.json
+//
+//	jsonSchema:
+//	  path: $.data.film
+//	  schema:
+//	    type: object
+//	    required: [id, title]
+type FlowStepJsonSchema struct {
+	// The json path of the validated value, the whole response by default
+	Path string `yaml:",omitempty"`
+	// A JSON or yaml schema file relative to the flow file
+	File string `yaml:",omitempty"`
+	// An inline schema
+	Schema interface{} `yaml:",omitempty"`
+}
+
+// Accept a file name as a shorthand for the full definition
+func (s *FlowStepJsonSchema) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var file string
+	if err := unmarshal(&file); err == nil {
+		s.File = file
+		return nil
+	}
+	type plain FlowStepJsonSchema
+	return unmarshal((*plain)(s))
+}
+
+// Convert the maps decoded by yaml to maps that can be encoded to JSON
+func yamlToJson(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			result[fmt.Sprint(key)] = yamlToJson(value)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, value := range t {
+			result[i] = yamlToJson(value)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// Compile the schema
+func (s *FlowStepJsonSchema) compile(basePath string) (*jsonschema.Schema, error) {
+	var data []byte
+	url := "inline.json"
+
+	if len(s.File) > 0 {
+		target := s.File
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(basePath, target)
+		}
+		content, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		// Convert yaml schema to JSON
+		ext := strings.ToLower(filepath.Ext(target))
+		if ext == ".yml" || ext == ".yaml" {
+			var v interface{}
+			if err := yaml.Unmarshal(content, &v); err != nil {
+				return nil, err
+			}
+			content, err = json.Marshal(yamlToJson(v))
+			if err != nil {
+				return nil, err
+			}
+		}
+		data = content
+		url = target
+	} else if s.Schema != nil {
+		content, err := json.Marshal(yamlToJson(s.Schema))
+		if err != nil {
+			return nil, err
+		}
+		data = content
+	} else {
+		return nil, fmt.Errorf("no schema or file defined")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// Collect the leaf errors of a validation error
+func flattenValidationError(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, flattenValidationError(cause)...)
+	}
+	return leaves
+}
+
+// Validate the response
+//
+// Each violation is returned as a separate error with the JSON pointer of the invalid value
+func (s *FlowStepJsonSchema) Validate(response interface{}, basePath string) []error {
+	schema, err := s.compile(basePath)
+	if err != nil {
+		return []error{fmt.Errorf("invalid json schema: %v", err)}
+	}
+
+	data := response
+	path := "$"
+	if len(s.Path) > 0 {
+		path = s.Path
+		data, err = jsonpath.Get(s.Path, response)
+		if err != nil {
+			return []error{fmt.Errorf("unable to load jsonpath: %v, %v", s.Path, err)}
+		}
+	}
+
+	err = schema.Validate(data)
+	if err == nil {
+		return nil
+	}
+
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return []error{err}
+	}
+
+	var result []error
+	for _, violation := range flattenValidationError(validationError) {
+		pointer := violation.InstanceLocation
+		if len(pointer) == 0 {
+			pointer = "/"
+		}
+		result = append(result, fmt.Errorf("json schema violation at %v#%v: %v", path, pointer, violation.Message))
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package flow
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// The flows to run for each combination of the matrix
+//
+//	matrix:
+//	  role: [admin, guest]
+//	  lang: [en, fr]
+//
+// runs the flow 4 times, `.Matrix.role` and `.Matrix.lang` give the values of
+// the combination in the templates. A flow without matrix is returned as is.
+func (f *FlowDefinition) Expand() []*FlowDefinition {
+	if len(f.Matrix) == 0 {
+		return []*FlowDefinition{f}
+	}
+
+	keys := make([]string, 0, len(f.Matrix))
+	for key := range f.Matrix {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	combinations := []map[string]interface{}{{}}
+	for _, key := range keys {
+		next := []map[string]interface{}{}
+		for _, combination := range combinations {
+			for _, value := range f.Matrix[key] {
+				c := maps.Clone(combination)
+				c[key] = yamlToJson(value)
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+
+	flows := make([]*FlowDefinition, len(combinations))
+	for i, combination := range combinations {
+		clone := f.Clone()
+		clone.MatrixValues = combination
+		clone.source = f
+		clone.Name = fmt.Sprintf("%v [%v]", f.Name, matrixLabel(combination, ", "))
+		flows[i] = clone
+	}
+	return flows
+}
+
+// The values of a combination of the matrix as `key=value` sorted by key
+func matrixLabel(combination map[string]interface{}, separator string) string {
+	keys := make([]string, 0, len(combination))
+	for key := range combination {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%v=%v", key, stringValue(combination[key]))
+	}
+	return strings.Join(parts, separator)
+}
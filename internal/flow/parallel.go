@@ -0,0 +1,69 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Run the steps of a parallel group at the same time
+//
+//	steps:
+//	  - name: load
+//	    parallel:
+//	      - name: films
+//	        query: allFilms
+//	      - name: people
+//	        query: allPeople
+//
+// Each step works on a copy of the state, the values stored by the steps are
+// merged in the order of the group once they have all completed.
+func (step *FlowStep) runParallel(flow *FlowDefinition, options *RunOption) *StepResult {
+	templateContext := flow.templateContext(step, options.Logger)
+
+	result := &StepResult{
+		Name:     step.NameParsed(templateContext),
+		State:    make(map[string]interface{}),
+		Children: make([]*StepResult, len(step.Parallel)),
+		logger:   options.Logger,
+	}
+
+	result.Verbosef("running %v steps in parallel", len(step.Parallel))
+
+	loggers := make([]*log.Logger, len(step.Parallel))
+	// Each step draws from its own generators, whatever the order the steps run in
+	randoms := flow.random.Split(len(step.Parallel))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range step.Parallel {
+		childFlow := *flow
+		childFlow.State = maps.Clone(flow.State)
+		childFlow.random = randoms[i]
+
+		childOptions := *options
+		childOptions.Logger = options.Logger.Buffered()
+		loggers[i] = childOptions.Logger
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// The steps of the group share the item of a foreach
+			child := step.Parallel[i]
+			child.item, child.index = step.item, step.index
+			result.Children[i] = child.Run(&childFlow, &childOptions)
+		}(i)
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	// Merge the output and the state of the steps in order
+	for i, child := range result.Children {
+		loggers[i].Flush()
+		for name, value := range child.State {
+			result.State[name] = value
+			flow.State[name] = value
+		}
+	}
+	return result
+}
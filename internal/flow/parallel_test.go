@@ -0,0 +1,46 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"gograph/internal/template"
+	"strings"
+	"testing"
+)
+
+// The random values of the steps of a group only depend on the seed of the flow
+func TestParallelFollowsSeed(t *testing.T) {
+	run := func() []string {
+		f := LoadFlowDefinition([]byte(`
+steps:
+  - name: group
+    parallel:
+      - name: a
+      - name: b
+      - name: c
+      - name: d
+`), "")
+		// Several templates per step so that the steps interleave
+		for i := range f.Steps[0].Parallel {
+			child := &f.Steps[0].Parallel[i]
+			child.Name = child.Name + strings.Repeat(" {{ uuid }}", 50)
+			child.Skip = `{{ uuid }}{{ randomEmail }}`
+		}
+		f.random = template.NewRandom(7)
+		result := f.Steps[0].Run(f, &RunOption{Logger: log.Discard})
+		names := []string{}
+		for _, child := range result.Children {
+			names = append(names, child.Name)
+		}
+		return names
+	}
+
+	expected := run()
+	for i := 0; i < 20; i++ {
+		names := run()
+		for j := range expected {
+			if names[j] != expected[j] {
+				t.Fatalf("expected %v, got %v", expected, names)
+			}
+		}
+	}
+}
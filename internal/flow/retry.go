@@ -0,0 +1,160 @@
+package flow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// FlowStepRetry
+// ----------------------------------------
+//
+// Run the step again until the response matches, to poll an eventually consistent API.
+//
+//	retry:
+//	  until:
+//	    - path: $.data.job.status
+//	      equals: DONE
+//	  interval: 2s
+//	  timeout: 60s
+//	  maxAttempts: 10
+//
+// Without `until` the step is run again until it succeeds. Only the errors of
+// the last attempt are reported.
+type FlowStepRetry struct {
+	// Checks on the response of the last query of the step
+	Until []FlowStepValue `yaml:",omitempty"`
+	// Wait between two attempts, 1s by default
+	Interval string `yaml:",omitempty"`
+	// Maximum time spent on the attempts, 30s by default when maxAttempts is not set,
+	// a timeout of 0 requires maxAttempts
+	Timeout string `yaml:",omitempty"`
+	// Maximum number of attempts
+	MaxAttempts int `yaml:"maxAttempts,omitempty"`
+}
+
+// Parse a duration of the retry, the default is used when empty
+func parseRetryDuration(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retry %v: %w", name, err)
+	}
+	return d, nil
+}
+
+// Check the `until` conditions on the response of an attempt
+func (step *FlowStep) retryFailures(flow *FlowDefinition, result *StepResult) []string {
+	if len(step.Retry.Until) == 0 {
+		failures := []string{}
+		for _, err := range result.Errors {
+			failures = append(failures, err.Error())
+		}
+		return failures
+	}
+
+	queryResult, ok := result.Result.(*GraphqlRunResult)
+	if !ok || queryResult == nil || queryResult.Reponse == nil {
+		return []string{"no response"}
+	}
+	responseJson, err := queryResult.Reponse.Json()
+	if err != nil {
+		return []string{"unable to parse response json"}
+	}
+
+	templateContext := flow.templateContext(step, result.logger)
+	failures := []string{}
+	for _, value := range step.Retry.Until {
+		data, err := jsonpath.Get(value.Path, responseJson)
+		found := err == nil
+		if found && len(value.Name) > 0 {
+			result.State[value.Name] = data
+			flow.State[value.Name] = data
+		}
+		for _, failure := range value.Check(data, found, templateContext) {
+			failures = append(failures, fmt.Sprintf("%v: %v", value.Path, failure))
+		}
+	}
+	flow.registerSecrets()
+	return failures
+}
+
+// Run the step until the `until` conditions pass, the attempts time out or the
+// maximum number of attempts is reached
+func (step *FlowStep) runRetry(flow *FlowDefinition, options *RunOption) *StepResult {
+	interval, err := parseRetryDuration("interval", step.Retry.Interval, time.Second)
+	if err == nil {
+		defaultTimeout := 30 * time.Second
+		if step.Retry.MaxAttempts > 0 {
+			defaultTimeout = 0
+		}
+		var timeout time.Duration
+		timeout, err = parseRetryDuration("timeout", step.Retry.Timeout, defaultTimeout)
+		if err == nil && timeout <= 0 && step.Retry.MaxAttempts <= 0 {
+			// A condition that never holds would retry forever
+			err = fmt.Errorf("retry needs a timeout or maxAttempts")
+		}
+		if err == nil {
+			return step.retry(flow, options, interval, timeout)
+		}
+	}
+
+	result := &StepResult{
+		Name:   step.NameParsed(flow.templateContext(step, options.Logger)),
+		State:  make(map[string]interface{}),
+		logger: options.Logger,
+	}
+	result.Errorf("%v", err)
+	return result
+}
+
+func (step *FlowStep) retry(flow *FlowDefinition, options *RunOption, interval, timeout time.Duration) *StepResult {
+	attempt := *step
+	attempt.Retry = nil
+
+	start := time.Now()
+	for n := 1; ; n++ {
+		// Only the output of the last attempt is kept
+		attemptOptions := *options
+		attemptOptions.Logger = options.Logger.Buffered()
+
+		result := attempt.Run(flow, &attemptOptions)
+		result.Attempts = n
+		result.logger = options.Logger
+
+		failures := step.retryFailures(flow, result)
+		if len(failures) == 0 {
+			attemptOptions.Logger.Flush()
+			if n > 1 {
+				result.Verbosef("succeeded after %v attempts", n)
+			}
+			return result
+		}
+
+		elapsed := time.Since(start)
+		exhausted := step.Retry.MaxAttempts > 0 && n >= step.Retry.MaxAttempts
+		expired := timeout > 0 && elapsed+interval > timeout
+		if exhausted || expired {
+			attemptOptions.Logger.Flush()
+			if len(step.Retry.Until) > 0 {
+				for _, failure := range failures {
+					result.Errorf("retry until %v", failure)
+				}
+			}
+			result.Errorf("gave up after %v attempts in %v", n, elapsed.Round(time.Millisecond))
+			return result
+		}
+
+		options.Logger.Verbosef("Step[%v] attempt %v failed, retrying in %v", result.Name, n, interval)
+		select {
+		case <-time.After(interval):
+		case <-options.context().Done():
+			attemptOptions.Logger.Flush()
+			result.Errorf("interrupted after %v attempts", n)
+			return result
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"strings"
+	"testing"
+)
+
+func TestRetryBounds(t *testing.T) {
+	// The step has no endpoint, all its attempts fail
+	tests := []struct {
+		name     string
+		retry    FlowStepRetry
+		attempts int
+		error    string
+	}{
+		{"max attempts", FlowStepRetry{Interval: "1ms", MaxAttempts: 3}, 3, "gave up after 3 attempts"},
+		{"max attempts without timeout", FlowStepRetry{Interval: "1ms", Timeout: "0s", MaxAttempts: 2}, 2, "gave up after 2 attempts"},
+		{"timeout", FlowStepRetry{Interval: "1ms", Timeout: "20ms"}, 0, "gave up after"},
+		{"no bound", FlowStepRetry{Interval: "1ms", Timeout: "0s"}, 0, "retry needs a timeout or maxAttempts"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFlowDefinition("")
+			step := &FlowStep{Name: "poll", Query: "job", Retry: &test.retry}
+
+			result := step.Run(f, &RunOption{Logger: log.Discard})
+			if test.attempts > 0 && result.Attempts != test.attempts {
+				t.Errorf("expected %v attempts, got %v", test.attempts, result.Attempts)
+			}
+			if len(result.Errors) == 0 || !strings.HasPrefix(result.Errors[len(result.Errors)-1].Error(), test.error) {
+				t.Errorf("expected the error %v, got %v", test.error, result.Errors)
+			}
+		})
+	}
+}
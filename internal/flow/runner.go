@@ -1,78 +1,219 @@
 package flow
 
 import (
+	"context"
 	"fmt"
 	"gograph/internal/log"
+	"gograph/internal/template"
+	"gograph/internal/util"
 	"io"
+	"net/http"
+	"time"
 )
 
 type FlowRunner struct {
 	flow    *FlowDefinition
+	options *RunOption
 	step    uint
+	seed    int64
 	results []*StepResult
 }
 
 type RunOption struct {
-	BreakAfterStepNamed string
+	// Seed overriding the one of the flow definition
+	Seed *int64
+
+	// Overwrite the existing snapshots with the responses
+	UpdateSnapshots bool
+
+	// Transport of the http requests, used to record the traffic
+	Transport http.RoundTripper
+
+	// Output of the flow, a buffered logger keeps it grouped when the flows run in parallel
+	Logger *log.Logger
+
+	// Use the shared random generators of the templates instead of generators
+	// seeded for the flow, for the virtual users of a load run
+	KeepSeed bool
+
+	// Cancelled to interrupt the run, the teardown and the `always` steps still run
+	Context context.Context
+}
+
+func (o *RunOption) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
 }
 
 func (f *FlowRunner) Run(options *RunOption) {
-	f.results = make([]*StepResult, len(f.flow.Steps))
-	for i, step := range f.flow.Steps {
+	f.options = options
 
-		result := f.RunStep(uint(i))
+	// Nothing is run once interrupted
+	if f.Interrupted() {
+		return
+	}
+
+	// Seed the random generators so that a run can be reproduced
+	switch {
+	case options.Seed != nil:
+		f.seed = *options.Seed
+	case f.flow.Seed != nil:
+		f.seed = *f.flow.Seed
+	default:
+		f.seed = time.Now().UnixNano()
+	}
+	// Each flow has its own generators, the flows running in parallel don't
+	// draw from each other
+	if !options.KeepSeed {
+		f.flow.random = template.NewRandom(f.seed)
+	}
+	options.Logger.Verbosef("[%v] using seed %v", f.flow.Name, f.seed)
+
+	// Load the schemas before the steps, they are shared by the steps running in parallel
+	if err := f.flow.LoadEnpoints(); err != nil {
+		options.Logger.Println("unable to load the schemas:", err)
+	}
 
-		if len(options.BreakAfterStepNamed) > 0 {
+	// The initial values of the State can be secrets
+	f.flow.registerSecrets()
 
-			if step.Name == options.BreakAfterStepNamed {
-				break
+	f.results = make([]*StepResult, 0, len(f.flow.Setup)+len(f.flow.Steps)+len(f.flow.Teardown))
+
+	// The steps are skipped after a failure of the setup
+	aborted := f.runSteps(f.flow.Setup, false)
+	aborted = f.runSteps(f.flow.Steps, aborted)
+
+	// The teardown runs even after a failure or an interrupt
+	if len(f.flow.Teardown) > 0 {
+		options.Logger.Verbosef("[%v] teardown", f.flow.Name)
+		for i := range f.flow.Teardown {
+			f.runStep(&f.flow.Teardown[i], f.uninterruptible())
+			options.Logger.Println("")
+		}
+	}
+}
+
+// Run a list of steps until one fails, only the steps with `always` run after
+// a failure or an interrupt
+//
+// Return true if the flow has been aborted
+func (f *FlowRunner) runSteps(steps []FlowStep, aborted bool) bool {
+	for i := range steps {
+		step := &steps[i]
+
+		interrupted := f.Interrupted()
+		if aborted || interrupted {
+			if !step.Always {
+				continue
 			}
+			f.runStep(step, f.uninterruptible())
+			f.options.Logger.Println("")
+			continue
 		}
-		log.Println("")
+
+		result := f.runStep(step, f.options)
+		f.options.Logger.Println("")
 
 		if result.HasError() && !step.Result.ContinueOnFailure {
-			log.Println("Aborting")
-			log.Println("")
+			f.options.Logger.Println("Aborting")
+			f.options.Logger.Println("")
 
-			return
+			aborted = true
 		}
-
 	}
+	return aborted
+}
+
+// The options of the steps that must complete even when the run is interrupted
+func (f *FlowRunner) uninterruptible() *RunOption {
+	options := *f.options
+	options.Context = context.WithoutCancel(f.options.context())
+	return &options
+}
+
+// Check if the run has been interrupted
+func (f *FlowRunner) Interrupted() bool {
+	return f.options != nil && f.options.context().Err() != nil
 }
 
 func (f *FlowRunner) RunStep(step uint) *StepResult {
 	if f.step >= uint(len(f.flow.Steps)) {
 		log.Fatalln("Step overflow", step, ">=", len(f.flow.Steps))
 	}
-	stepDef := f.flow.Steps[step]
+	return f.runStep(&f.flow.Steps[step], f.options)
+}
 
-	result := stepDef.Run(f.flow)
+func (f *FlowRunner) runStep(stepDef *FlowStep, options *RunOption) *StepResult {
+	result := stepDef.Run(f.flow, options)
+	f.flow.registerSecrets()
 	// Store result
 	f.results = append(f.results, result)
 	f.DumpStepResult(result)
 	return result
 }
 
+// The flow definition being run
+func (f *FlowRunner) Flow() *FlowDefinition {
+	return f.flow
+}
+
+// The results of the steps that have run
+func (f *FlowRunner) Results() []*StepResult {
+	return f.results
+}
+
+// The seed used for the random values
+func (f *FlowRunner) Seed() int64 {
+	return f.seed
+}
+
+// Check if a step has failed
+func (f *FlowRunner) HasError() bool {
+	for _, result := range f.results {
+		if result != nil && result.HasError() {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *FlowRunner) Summarize(w io.Writer) {
 
-	w.Write([]byte(fmt.Sprintf("[%v] Summary\n", f.flow.Name)))
+	w.Write([]byte(fmt.Sprintf("[%v] Summary (seed: %v)\n", f.flow.Name, f.seed)))
+	if f.Interrupted() {
+		w.Write([]byte("- interrupted\n"))
+	}
 	for _, result := range f.results {
 		if result == nil {
 			continue
 		}
-		var status string
-		if result.HasError() {
-			status = "ER"
-		} else {
-			status = "OK"
-		}
+		summarizeStepResult(w, result, "")
+	}
+}
 
-		w.Write([]byte(fmt.Sprintf("- [%v] %v\n", status, result.Name)))
-		if result.HasError() {
-			for _, err := range result.Errors {
-				w.Write([]byte(fmt.Sprintf("  - %v\n", err)))
-			}
-		}
+func summarizeStepResult(w io.Writer, result *StepResult, indent string) {
+	if result.IsSkipped() {
+		w.Write([]byte(fmt.Sprintf("%v- [SKIP] %v (%v)\n", indent, result.Name, result.Skipped)))
+		return
+	}
+
+	status := "OK"
+	if result.HasError() {
+		status = "ER"
+	}
+
+	details := result.Duration.Round(time.Millisecond).String()
+	if result.Attempts > 1 {
+		details = fmt.Sprintf("%v, %v attempts", details, result.Attempts)
+	}
+	w.Write([]byte(fmt.Sprintf("%v- [%v] %v (%v)\n", indent, status, result.Name, details)))
+	for _, err := range result.Errors {
+		w.Write([]byte(fmt.Sprintf("%v  - %v\n", indent, err)))
+	}
+	for _, child := range result.Children {
+		summarizeStepResult(w, child, indent+"  ")
 	}
 }
 
@@ -81,19 +222,26 @@ func (f *FlowRunner) DumpStepResult(result *StepResult) {
 		return
 	}
 
+	for _, child := range result.Children {
+		f.DumpStepResult(child)
+	}
+
 	rstring := "OK"
 	if result.HasError() {
 		rstring = "KO"
+	} else if result.IsSkipped() {
+		rstring = "SKIP"
 	}
 
-	log.Printf("[%v] results: %v", result.Name, rstring)
+	logger := f.options.Logger
+	logger.Printf("[%v] results: %v (%v)", result.Name, rstring, result.Duration.Round(time.Millisecond))
 	for _, err := range result.Errors {
-		log.Println("    - ", err)
+		logger.Println("    - ", err)
 	}
 	if len(result.State) > 0 {
-		log.Println("  state:", len(result.State))
+		logger.Println("  state:", len(result.State))
 		for k, v := range result.State {
-			log.Printf("    - %v: %v", k, v)
+			logger.Printf("    - %v: %v", k, util.JsonPrint(v))
 		}
 	}
 }
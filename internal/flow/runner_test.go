@@ -0,0 +1,24 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"testing"
+)
+
+func TestSeedZero(t *testing.T) {
+	base := LoadFlowDefinition([]byte("seed: 42\n"), "")
+	f := LoadFlowDefinition([]byte("seed: 0\n"), "").mergeOver(base)
+
+	runner := NewFlowRunner(f)
+	runner.Run(&RunOption{Logger: log.Discard})
+	if runner.Seed() != 0 {
+		t.Errorf("expected the seed 0 of the flow, got %v", runner.Seed())
+	}
+
+	override := int64(0)
+	runner = NewFlowRunner(base)
+	runner.Run(&RunOption{Logger: log.Discard, Seed: &override})
+	if runner.Seed() != 0 {
+		t.Errorf("expected the seed 0 of the options, got %v", runner.Seed())
+	}
+}
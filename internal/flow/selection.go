@@ -0,0 +1,136 @@
+package flow
+
+import (
+	"gograph/internal/log"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selection
+// ----------------------------------------
+//
+// The steps to run among the flows. The steps are selected in the order of the
+// flows, `From` and `Until` can be in different files.
+//
+// The names are matched with globs: `Get film*`. The setup, the teardown and
+// the `always` steps of a flow always run when one of its steps is selected.
+type Selection struct {
+	// Run only the steps matching one of the names
+	Only []string
+	// Don't run the steps matching one of the names
+	Skip []string
+	// Start with the step matching the name
+	From string
+	// Stop after the step matching the name
+	Until string
+	// Run the steps with one of the tags, `!tag` excludes the steps with the tag.
+	// The tags of a flow apply to its steps.
+	Tags []string
+}
+
+// Check if a step name matches one of the globs
+func matchName(name string, globs []string) bool {
+	for _, glob := range globs {
+		if glob == name {
+			return true
+		}
+		if matched, err := path.Match(glob, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a list of tags is selected by the tag filters
+func (s *Selection) matchTags(tags []string) bool {
+	included := false
+	hasIncluded := false
+	for _, filter := range s.Tags {
+		if excluded, ok := strings.CutPrefix(filter, "!"); ok {
+			if slices.Contains(tags, excluded) {
+				return false
+			}
+			continue
+		}
+		hasIncluded = true
+		if slices.Contains(tags, filter) {
+			included = true
+		}
+	}
+	return included || !hasIncluded
+}
+
+// Keep the selected steps of the flows, the flows without selected steps are removed
+//
+// The combinations of a matrix are selected like the flow they are expanded
+// from. The steps with `always` are kept in the selected flows, they are cleanups.
+func (s *Selection) Filter(flows []*FlowDefinition) []*FlowDefinition {
+	started := len(s.From) == 0
+	stopped := false
+
+	// The state of `From` and `Until` at the start of the current matrix
+	var source *FlowDefinition
+	sourceStarted, sourceStopped := started, stopped
+
+	selected := []*FlowDefinition{}
+	for _, f := range flows {
+		if f.source != nil && f.source == source {
+			started, stopped = sourceStarted, sourceStopped
+		} else {
+			source = f.source
+			sourceStarted, sourceStopped = started, stopped
+		}
+
+		steps := []FlowStep{}
+		found := false
+		for _, step := range f.Steps {
+			if !started && matchName(step.Name, []string{s.From}) {
+				started = true
+			}
+			if !started || stopped {
+				if step.Always {
+					steps = append(steps, step)
+				}
+				continue
+			}
+			if len(s.Until) > 0 && matchName(step.Name, []string{s.Until}) {
+				stopped = true
+			}
+
+			if s.selected(f, &step) {
+				found = true
+				steps = append(steps, step)
+			} else if step.Always {
+				steps = append(steps, step)
+			}
+		}
+
+		if !found {
+			log.Verbosef("[%v] no step selected", f.Name)
+			continue
+		}
+		clone := f.Clone()
+		clone.Steps = steps
+		selected = append(selected, clone)
+	}
+
+	if !started {
+		log.Println("Step not found:", s.From)
+	}
+	if len(s.Until) > 0 && !stopped {
+		log.Println("Step not found:", s.Until)
+	}
+	return selected
+}
+
+// Check if a step matches the names and the tags of the selection
+func (s *Selection) selected(f *FlowDefinition, step *FlowStep) bool {
+	if len(s.Only) > 0 && !matchName(step.Name, s.Only) {
+		return false
+	}
+	if matchName(step.Name, s.Skip) {
+		return false
+	}
+	return s.matchTags(append(slices.Clone(f.Tags), step.Tags...))
+}
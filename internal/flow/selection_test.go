@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"slices"
+	"testing"
+)
+
+func newSelectionFlow(name string, steps ...FlowStep) *FlowDefinition {
+	f := NewFlowDefinition("")
+	f.Name = name
+	f.Steps = steps
+	return f
+}
+
+func stepNames(f *FlowDefinition) []string {
+	names := []string{}
+	for _, step := range f.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestFilterMatrixFromUntil(t *testing.T) {
+	f := newSelectionFlow("matrix", FlowStep{Name: "a"}, FlowStep{Name: "b"}, FlowStep{Name: "c"})
+	f.Matrix = map[string][]interface{}{"role": {"admin", "guest"}}
+
+	tests := []struct {
+		name      string
+		selection Selection
+		expected  []string
+	}{
+		{"until", Selection{Until: "b"}, []string{"a", "b"}},
+		{"from", Selection{From: "b"}, []string{"b", "c"}},
+		{"from until", Selection{From: "b", Until: "b"}, []string{"b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := test.selection.Filter(f.Expand())
+			if len(selected) != 2 {
+				t.Fatalf("expected the 2 combinations, got %v", len(selected))
+			}
+			for _, combination := range selected {
+				if names := stepNames(combination); !slices.Equal(names, test.expected) {
+					t.Errorf("%v: expected steps %v, got %v", combination.Name, test.expected, names)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterAcrossFlows(t *testing.T) {
+	first := newSelectionFlow("first", FlowStep{Name: "a"}, FlowStep{Name: "b"})
+	second := newSelectionFlow("second", FlowStep{Name: "c"}, FlowStep{Name: "d"})
+
+	selected := (&Selection{From: "b", Until: "c"}).Filter([]*FlowDefinition{first, second})
+	if len(selected) != 2 {
+		t.Fatalf("expected 2 flows, got %v", len(selected))
+	}
+	if names := stepNames(selected[0]); !slices.Equal(names, []string{"b"}) {
+		t.Errorf("expected steps [b], got %v", names)
+	}
+	if names := stepNames(selected[1]); !slices.Equal(names, []string{"c"}) {
+		t.Errorf("expected steps [c], got %v", names)
+	}
+}
+
+func TestFilterKeepsAlwaysSteps(t *testing.T) {
+	newFlow := func() *FlowDefinition {
+		return newSelectionFlow("cleanup",
+			FlowStep{Name: "create", Tags: []string{"smoke"}},
+			FlowStep{Name: "check"},
+			FlowStep{Name: "delete", Always: true},
+		)
+	}
+
+	tests := []struct {
+		name      string
+		selection Selection
+		expected  []string
+	}{
+		{"only", Selection{Only: []string{"create"}}, []string{"create", "delete"}},
+		{"skip", Selection{Skip: []string{"delete"}}, []string{"create", "check", "delete"}},
+		{"tags", Selection{Tags: []string{"smoke"}}, []string{"create", "delete"}},
+		{"until", Selection{Until: "create"}, []string{"create", "delete"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := test.selection.Filter([]*FlowDefinition{newFlow()})
+			if len(selected) != 1 {
+				t.Fatalf("expected 1 flow, got %v", len(selected))
+			}
+			if names := stepNames(selected[0]); !slices.Equal(names, test.expected) {
+				t.Errorf("expected steps %v, got %v", test.expected, names)
+			}
+		})
+	}
+
+	// A flow is not run for its cleanups only
+	selected := (&Selection{Only: []string{"nothing"}}).Filter([]*FlowDefinition{newFlow()})
+	if len(selected) != 0 {
+		t.Errorf("expected no flow, got %v", len(selected))
+	}
+}
@@ -0,0 +1,373 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gograph/internal/secret"
+	"gograph/internal/util"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// Value replacing the ignored paths in the snapshots
+const snapshotIgnored = "<ignored>"
+
+// Language of the ignore paths, the placeholders of the json object keys give
+// the keys of the values matched by a selector
+var ignoreLanguage = gval.Full(jsonpath.PlaceholderExtension())
+
+// Replace the values matched by a list of json paths with a placeholder
+//
+// jsonpath only returns values, the paths are split before their last selector
+// to find the location of the matches: the first part gives the containers on
+// which the last selector is evaluated. Both are evaluated on the data so that
+// the filters see the real values.
+func ignorePaths(data interface{}, paths []string) (interface{}, error) {
+	if len(paths) == 0 {
+		return data, nil
+	}
+
+	// Copy of the data where the matches are replaced, by container of the data
+	copies := make(map[uintptr]interface{})
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			c := make(map[string]interface{}, len(t))
+			for key, item := range t {
+				c[key] = walk(item)
+			}
+			copies[reflect.ValueOf(t).Pointer()] = c
+			return c
+		case []interface{}:
+			c := make([]interface{}, len(t))
+			for i, item := range t {
+				c[i] = walk(item)
+			}
+			if len(t) > 0 {
+				copies[reflect.ValueOf(t).Pointer()] = c
+			}
+			return c
+		default:
+			return v
+		}
+	}
+	result := walk(data)
+
+	for _, path := range paths {
+		if _, err := ignoreLanguage.NewEvaluable("{#: " + path + "}"); err != nil {
+			return nil, fmt.Errorf("invalid ignore path %v: %w", path, err)
+		}
+
+		prefix, selector := splitLastSelector(path)
+		if len(selector) == 0 {
+			// The whole response is ignored
+			result = snapshotIgnored
+			continue
+		}
+
+		parents, err := evaluateMatches(prefix, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore path %v: %w", path, err)
+		}
+		if recursive, ok := strings.CutPrefix(selector, ".."); ok {
+			// The recursive descent applies to the parents and all their descendants
+			parents = descendants(parents)
+			selector = "$." + recursive
+			if strings.HasPrefix(recursive, "[") {
+				selector = "$" + recursive
+			}
+		} else {
+			selector = "$" + selector
+		}
+
+		matched := 0
+		for _, parent := range parents {
+			switch parent.(type) {
+			case map[string]interface{}, []interface{}:
+			default:
+				continue
+			}
+			keys, err := matchedKeys(selector, parent)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ignore path %v: %w", path, err)
+			}
+			for _, key := range keys {
+				switch c := copies[reflect.ValueOf(parent).Pointer()].(type) {
+				case map[string]interface{}:
+					c[key] = snapshotIgnored
+					matched++
+				case []interface{}:
+					if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(c) {
+						c[i] = snapshotIgnored
+						matched++
+					}
+				}
+			}
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("ignore path %v matches nothing", path)
+		}
+	}
+	return result, nil
+}
+
+// Split a json path before its last selector, `$.a[*].b` gives `$.a[*]` and `.b`
+func splitLastSelector(path string) (string, string) {
+	last := len(path)
+	depth := 0
+	var quote rune
+	escaped := false
+	for i, c := range path {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			if c == '[' && depth == 0 && !strings.HasSuffix(path[:i], "..") {
+				last = i
+			}
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == '.' && depth == 0:
+			if !strings.HasSuffix(path[:i], ".") {
+				last = i
+			}
+		}
+	}
+	return path[:last], path[last:]
+}
+
+// The values matched by a json path
+func evaluateMatches(path string, data interface{}) ([]interface{}, error) {
+	eval, err := ignoreLanguage.NewEvaluable("{#: " + path + "}")
+	if err != nil {
+		return nil, err
+	}
+	matches, err := eval(context.Background(), data)
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	for _, value := range matches.(map[string]interface{}) {
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// The containers and all the containers they contain
+func descendants(values []interface{}) []interface{} {
+	all := []interface{}{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			all = append(all, t)
+			for _, item := range t {
+				walk(item)
+			}
+		case []interface{}:
+			all = append(all, t)
+			for _, item := range t {
+				walk(item)
+			}
+		}
+	}
+	for _, value := range values {
+		walk(value)
+	}
+	return all
+}
+
+// The keys of a container matched by a single selector such as `$.a`, `$[*]`
+// or `$[?(@.id)]`
+func matchedKeys(selector string, parent interface{}) ([]string, error) {
+	eval, err := ignoreLanguage.NewEvaluable("{#: " + selector + "}")
+	if err != nil {
+		return nil, err
+	}
+	matches, err := eval(context.Background(), parent)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for placeholder := range matches.(map[string]interface{}) {
+		if placeholder != "$" {
+			// An ambiguous selector gives the quoted key: $["key"]
+			key, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(placeholder, "$["), "]"))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			continue
+		}
+
+		// A plain selector doesn't give its key, it is found by evaluating the
+		// selector on a copy of the container holding the keys as values
+		var shadow interface{}
+		switch t := parent.(type) {
+		case map[string]interface{}:
+			m := make(map[string]interface{}, len(t))
+			for key := range t {
+				m[key] = key
+			}
+			shadow = m
+		case []interface{}:
+			l := make([]interface{}, len(t))
+			for i := range t {
+				l[i] = strconv.Itoa(i)
+			}
+			shadow = l
+		}
+		key, err := jsonpath.Get(selector, shadow)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// List the differences between two JSON values
+func jsonDiff(expected, actual interface{}, path string) []string {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		if a, ok := actual.(map[string]interface{}); ok {
+			keys := []string{}
+			for key := range e {
+				keys = append(keys, key)
+			}
+			for key := range a {
+				if _, ok := e[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+
+			diff := []string{}
+			for _, key := range keys {
+				ev, inExpected := e[key]
+				av, inActual := a[key]
+				keyPath := path + "." + key
+				switch {
+				case !inActual:
+					diff = append(diff, fmt.Sprintf("- %v: %v", keyPath, util.JsonPrint(ev)))
+				case !inExpected:
+					diff = append(diff, fmt.Sprintf("+ %v: %v", keyPath, util.JsonPrint(av)))
+				default:
+					diff = append(diff, jsonDiff(ev, av, keyPath)...)
+				}
+			}
+			return diff
+		}
+	case []interface{}:
+		if a, ok := actual.([]interface{}); ok {
+			diff := []string{}
+			for i := 0; i < len(e) || i < len(a); i++ {
+				itemPath := fmt.Sprintf("%v[%v]", path, i)
+				switch {
+				case i >= len(a):
+					diff = append(diff, fmt.Sprintf("- %v: %v", itemPath, util.JsonPrint(e[i])))
+				case i >= len(e):
+					diff = append(diff, fmt.Sprintf("+ %v: %v", itemPath, util.JsonPrint(a[i])))
+				default:
+					diff = append(diff, jsonDiff(e[i], a[i], itemPath)...)
+				}
+			}
+			return diff
+		}
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return []string{fmt.Sprintf("~ %v: %v => %v", path, util.JsonPrint(expected), util.JsonPrint(actual))}
+	}
+	return nil
+}
+
+// Location of a snapshot: __snapshots__/<flow>/<name>.json next to the flow file
+//
+// Each combination of the matrix has its own snapshots:
+// __snapshots__/<flow>/<key=value,...>/<name>.json
+func (f *FlowDefinition) SnapshotPath(name string) string {
+	return f.snapshotPath(f.BasePath, name)
+}
+
+// Location of a snapshot in the __snapshots__ directory of a base path, the
+// snapshots of the imported steps are next to the file defining them
+func (f *FlowDefinition) snapshotPath(basePath string, name string) string {
+	flowName := f.Name
+	if len(f.File) > 0 {
+		flowName = strings.TrimSuffix(filepath.Base(f.File), filepath.Ext(f.File))
+	}
+	unsafe := regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	flowName = unsafe.ReplaceAllString(flowName, "_")
+	name = unsafe.ReplaceAllString(name, "_")
+
+	dir := filepath.Join(basePath, "__snapshots__", flowName)
+	if len(f.MatrixValues) > 0 {
+		unsafeCombination := regexp.MustCompile(`[^A-Za-z0-9._=,-]+`)
+		dir = filepath.Join(dir, unsafeCombination.ReplaceAllString(matrixLabel(f.MatrixValues, ","), "_"))
+	}
+	return filepath.Join(dir, name+".json")
+}
+
+// Compare a response with the snapshot file
+//
+// The snapshot is written when it doesn't exist yet or when update is set,
+// otherwise the differences with the snapshot are returned.
+func (f *FlowDefinition) CheckSnapshot(file string, ignore []string, response interface{}, update bool) (written bool, diff []string, err error) {
+	// The secrets are masked on both sides, they are never written in the snapshots
+	ignored, err := ignorePaths(normalizeJson(response), ignore)
+	if err != nil {
+		return false, nil, err
+	}
+	normalized := secret.MaskValue(ignored)
+
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, nil, err
+	}
+
+	if err == nil && !update {
+		var expected interface{}
+		if err := json.Unmarshal(data, &expected); err != nil {
+			return false, nil, fmt.Errorf("invalid snapshot %v: %w", file, err)
+		}
+		return false, jsonDiff(secret.MaskValue(expected), normalized, "$"), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return false, nil, err
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(normalized); err != nil {
+		return false, nil, err
+	}
+	return true, nil, os.WriteFile(file, b.Bytes(), 0644)
+}
@@ -0,0 +1,85 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestIgnorePaths(t *testing.T) {
+	response := `{
+		"data": {
+			"films": [
+				{"id": "a", "episode": 4, "edited": "2024-01-01"},
+				{"id": "b", "episode": 5, "edited": "2024-02-01"},
+				{"episode": 6, "edited": "2024-03-01"}
+			],
+			"flags": {"a": true, "b": true}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		paths    []string
+		expected string
+	}{
+		{"plain", []string{"$.data.flags.a"}, `{"data": {"films": [
+			{"id": "a", "episode": 4, "edited": "2024-01-01"},
+			{"id": "b", "episode": 5, "edited": "2024-02-01"},
+			{"episode": 6, "edited": "2024-03-01"}
+		], "flags": {"a": "<ignored>", "b": true}}}`},
+		{"wildcard", []string{"$.data.films[*].edited"}, `{"data": {"films": [
+			{"id": "a", "episode": 4, "edited": "<ignored>"},
+			{"id": "b", "episode": 5, "edited": "<ignored>"},
+			{"episode": 6, "edited": "<ignored>"}
+		], "flags": {"a": true, "b": true}}}`},
+		{"recursive", []string{"$..id"}, `{"data": {"films": [
+			{"id": "<ignored>", "episode": 4, "edited": "2024-01-01"},
+			{"id": "<ignored>", "episode": 5, "edited": "2024-02-01"},
+			{"episode": 6, "edited": "2024-03-01"}
+		], "flags": {"a": true, "b": true}}}`},
+		{"filter", []string{`$..[?(@.id != null)]`}, `{"data": {"films": [
+			"<ignored>",
+			"<ignored>",
+			{"episode": 6, "edited": "2024-03-01"}
+		], "flags": {"a": true, "b": true}}}`},
+		{"filter on values", []string{`$.data.films[?(@.episode > 4)].edited`, `$.data.films[0]`}, `{"data": {"films": [
+			"<ignored>",
+			{"id": "b", "episode": 5, "edited": "<ignored>"},
+			{"episode": 6, "edited": "<ignored>"}
+		], "flags": {"a": true, "b": true}}}`},
+		{"root", []string{"$"}, `"<ignored>"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data, expected interface{}
+			if err := json.Unmarshal([]byte(response), &data); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			ignored, err := ignorePaths(data, test.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ignored, expected) {
+				t.Errorf("expected %v, got %v", expected, ignored)
+			}
+		})
+	}
+}
+
+func TestIgnorePathsErrors(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"data": {"films": [{"id": "a"}]}}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"$.data.films[", "$.data.people", "$..[?(@.id == \"b\")]"} {
+		if _, err := ignorePaths(data, []string{path}); err == nil {
+			t.Errorf("%v: expected an error", path)
+		}
+	}
+}
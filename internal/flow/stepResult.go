@@ -3,6 +3,7 @@ package flow
 import (
 	"fmt"
 	"gograph/internal/log"
+	"time"
 )
 
 type StepResult struct {
@@ -10,26 +11,49 @@ type StepResult struct {
 	Result any
 	State  map[string]interface{}
 	Errors []error
+
+	// Total duration of the queries of the step
+	Duration time.Duration
+
+	// Results of the steps of a parallel group or of a foreach
+	Children []*StepResult
+
+	// The reason the step was skipped, empty if it has run
+	Skipped string
+
+	// Number of times the step was run when it is retried
+	Attempts int
+
+	logger *log.Logger
 }
 
 func (step *StepResult) HasError() bool {
+	for _, child := range step.Children {
+		if child.HasError() {
+			return true
+		}
+	}
 	return step.Errors != nil && len(step.Errors) > 0
 }
 
+func (step *StepResult) IsSkipped() bool {
+	return len(step.Skipped) > 0
+}
+
 func (step *StepResult) Printf(format string, args ...any) {
-	log.Printf("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
+	step.logger.Printf("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
 }
 
 func (step *StepResult) Verbosef(format string, args ...any) {
-	log.Verbosef("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
+	step.logger.Verbosef("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
 }
 
 func (step *StepResult) Debugf(format string, args ...any) {
-	log.Debugf("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
+	step.logger.Debugf("Step[%v] %v", step.Name, fmt.Sprintf(format, args...))
 }
 
 func (step *StepResult) Errorf(format string, args ...any) {
 	err := fmt.Errorf(format, args...)
-	log.Printf("Step[%v] ERROR %v", step.Name, err)
+	step.logger.Printf("Step[%v] ERROR %v", step.Name, err)
 	step.Errors = append(step.Errors, err)
 }
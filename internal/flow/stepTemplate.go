@@ -0,0 +1,153 @@
+package flow
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Step templates
+// ----------------------------------------
+//
+// Steps shared by the steps of a flow, to write the common checks once:
+//
+//	stepTemplates:
+//	  ok:
+//	    result:
+//	      status: [200]
+//	      maxDuration: 2s
+//	steps:
+//	  - name: Get film
+//	    use: ok
+//	    query: film
+//
+// The template completes the step: the fields not set on the step are taken
+// from the template, the fields set on the step replace the ones of the
+// template, `false`, `0` and `[]` included. The fields of the `result` are
+// taken one by one. A template can use another template. The templates are
+// shared with the imported flows.
+
+// Decode a step and keep the keys set in the yaml, to tell an unset field
+// from a field set to its zero value when the step uses a template
+func (step *FlowStep) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FlowStep
+	if err := unmarshal((*plain)(step)); err != nil {
+		return err
+	}
+
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	step.fields = make(map[string]bool, len(keys))
+	for key, value := range keys {
+		step.fields[key] = true
+		if result, ok := value.(map[interface{}]interface{}); ok && key == "result" {
+			for resultKey := range result {
+				step.fields[fmt.Sprintf("result.%v", resultKey)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// Complete the steps of the flow with their templates
+func (f *FlowDefinition) useStepTemplates() error {
+	resolved := make(map[string]*FlowStep)
+	for _, steps := range [][]FlowStep{f.Setup, f.Steps, f.Teardown} {
+		for i := range steps {
+			if err := f.useStepTemplate(&steps[i], resolved, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Complete a step and its parallel steps with their templates
+//
+// The stack lists the templates being resolved to detect the cycles.
+func (f *FlowDefinition) useStepTemplate(step *FlowStep, resolved map[string]*FlowStep, stack []string) error {
+	for i := range step.Parallel {
+		if err := f.useStepTemplate(&step.Parallel[i], resolved, stack); err != nil {
+			return err
+		}
+	}
+	if len(step.Use) == 0 {
+		return nil
+	}
+
+	template, err := f.stepTemplate(step.Use, resolved, stack)
+	if err != nil {
+		// The templates have no name, the error is given for the step using them
+		if len(stack) > 0 {
+			return err
+		}
+		return fmt.Errorf("step %v: %w", step.Name, err)
+	}
+	step.complete(template)
+	step.Use = ""
+	return nil
+}
+
+// Get a step template completed with the templates it uses
+func (f *FlowDefinition) stepTemplate(name string, resolved map[string]*FlowStep, stack []string) (*FlowStep, error) {
+	if template, ok := resolved[name]; ok {
+		return template, nil
+	}
+	if slices.Contains(stack, name) {
+		return nil, fmt.Errorf("step template cycle: %v -> %v", strings.Join(stack, " -> "), name)
+	}
+	template, ok := f.StepTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown step template: %v", name)
+	}
+
+	if err := f.useStepTemplate(&template, resolved, append(slices.Clone(stack), name)); err != nil {
+		return nil, err
+	}
+	resolved[name] = &template
+	return &template, nil
+}
+
+// Complete the fields of a step not set in its yaml with the ones of a template
+func (step *FlowStep) complete(template *FlowStep) {
+	completeFields(reflect.ValueOf(step).Elem(), reflect.ValueOf(template).Elem(), "", func(key string, value reflect.Value) bool {
+		if step.fields == nil {
+			// A step not decoded from yaml
+			return !value.IsZero()
+		}
+		return step.fields[key]
+	})
+}
+
+// Set the fields of a struct not set with the ones of a template
+//
+// The fields are identified by their yaml key, the `result` is completed field by field.
+func completeFields(value, template reflect.Value, prefix string, isSet func(key string, value reflect.Value) bool) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		// The unexported fields are runtime values
+		if !field.IsExported() {
+			continue
+		}
+		key := yamlKey(field)
+		if prefix == "" && key == "result" {
+			completeFields(value.Field(i), template.Field(i), "result.", isSet)
+			continue
+		}
+		if !isSet(prefix+key, value.Field(i)) {
+			value.Field(i).Set(template.Field(i))
+		}
+	}
+}
+
+// The key of a struct field in yaml, the lowercased field name by default
+func yamlKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if len(name) == 0 {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
@@ -0,0 +1,112 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUseStepTemplates(t *testing.T) {
+	f := LoadFlowDefinition([]byte(`
+stepTemplates:
+  base:
+    query: film
+    tags: [smoke]
+    result:
+      status: [200]
+      ignoreSchema: true
+      maxDuration: 2s
+  created:
+    use: base
+    result:
+      status: [201]
+steps:
+  - name: inherited
+    use: base
+  - name: replaced
+    use: base
+    tags: []
+    result:
+      status: [201]
+      ignoreSchema: false
+  - name: nested
+    use: created
+`), "")
+
+	inherited, replaced, nested := f.Steps[0], f.Steps[1], f.Steps[2]
+
+	if inherited.Query != "film" || !slices.Equal(inherited.Result.Status, []int{200}) || !inherited.Result.IgnoreSchema {
+		t.Errorf("inherited: expected the fields of the template, got %+v", inherited)
+	}
+	if !slices.Equal(inherited.Tags, []string{"smoke"}) {
+		t.Errorf("inherited: expected tags [smoke], got %v", inherited.Tags)
+	}
+
+	if !slices.Equal(replaced.Result.Status, []int{201}) {
+		t.Errorf("replaced: expected status [201], got %v", replaced.Result.Status)
+	}
+	if replaced.Result.IgnoreSchema {
+		t.Errorf("replaced: expected ignoreSchema to be turned off")
+	}
+	if len(replaced.Tags) != 0 {
+		t.Errorf("replaced: expected no tags, got %v", replaced.Tags)
+	}
+	if replaced.Result.MaxDuration != "2s" || replaced.Query != "film" {
+		t.Errorf("replaced: expected the fields not set to be completed, got %+v", replaced)
+	}
+
+	if !slices.Equal(nested.Result.Status, []int{201}) || nested.Result.MaxDuration != "2s" {
+		t.Errorf("nested: expected the fields of both templates, got %+v", nested.Result)
+	}
+}
+
+func TestImportedStepPaths(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(shared, "steps.yml"): `
+stepTemplates:
+  checked:
+    result:
+      jsonSchema: film.json
+steps:
+  - name: imported
+    foreach:
+      dataFile: items.csv
+`,
+		filepath.Join(dir, "flow.yml"): `
+import: [shared/steps.yml]
+steps:
+  - name: own
+    use: checked
+`,
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := LoadFlowDefinitionFile(filepath.Join(dir, "flow.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, own := f.Steps[0], f.Steps[1]
+
+	if imported.dir(f) != shared {
+		t.Errorf("expected the imported step to be relative to %v, got %v", shared, imported.dir(f))
+	}
+	if own.dir(f) != dir {
+		t.Errorf("expected the step to be relative to %v, got %v", dir, own.dir(f))
+	}
+	if expected := filepath.Join(shared, "film.json"); own.Result.JsonSchema.File != expected {
+		t.Errorf("expected the json schema of the template %v, got %v", expected, own.Result.JsonSchema.File)
+	}
+	if expected := filepath.Join(shared, "__snapshots__", "flow", "films.json"); f.snapshotPath(imported.dir(f), "films") != expected {
+		t.Errorf("expected the snapshot %v, got %v", expected, f.snapshotPath(imported.dir(f), "films"))
+	}
+}
@@ -0,0 +1,330 @@
+package har
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"gograph/internal/secret"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP Archive 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type Har struct {
+	Log *Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator *Creator `json:"creator"`
+	Entries []*Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime string    `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *Request  `json:"request"`
+	Response        *Response `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         *Timings  `json:"timings"`
+	Comment         string    `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	Url         string      `json:"url"`
+	HttpVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HttpVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     *Content    `json:"content"`
+	RedirectUrl string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Durations in milliseconds, -1 when the phase does not apply
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Ssl     float64 `json:"ssl"`
+}
+
+// Value replacing the redacted headers and cookies
+const Redacted = "[REDACTED]"
+
+// Headers redacted by default
+var DefaultRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Recorder
+// ----------------------------------------
+//
+// A http.RoundTripper recording the exchanges in HAR format.
+//
+//	recorder := har.NewRecorder(nil, har.DefaultRedact)
+//	client := &http.Client{Transport: recorder}
+//	...
+//	recorder.WriteFile("out.har")
+type Recorder struct {
+	// Transport doing the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Name of the headers whose values are redacted
+	Redact []string
+
+	mutex   sync.Mutex
+	entries []*Entry
+}
+
+func NewRecorder(transport http.RoundTripper, redact []string) *Recorder {
+	return &Recorder{
+		Transport: transport,
+		Redact:    redact,
+		entries:   []*Entry{},
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// Read the body of the request, and restore it for the transport
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	timings := &Timings{Blocked: -1, Dns: -1, Connect: -1, Ssl: -1}
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { timings.Dns = millis(time.Since(dnsStart)) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { timings.Connect = millis(time.Since(connectStart)) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { timings.Ssl = millis(time.Since(tlsStart)) },
+		WroteRequest:      func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+	}))
+
+	entry := &Entry{
+		StartedDateTime: start.Format("2006-01-02T15:04:05.000Z07:00"),
+		Request:         r.request(req, requestBody),
+		Timings:         timings,
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if wroteRequest.IsZero() {
+		wroteRequest = time.Now()
+	}
+	timings.Wait = millis(time.Since(wroteRequest))
+	if err != nil {
+		entry.Response = &Response{
+			Cookies:     []NameValue{},
+			Headers:     []NameValue{},
+			Content:     &Content{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		entry.Comment = err.Error()
+		entry.Time = millis(time.Since(start))
+		r.add(entry)
+		return resp, err
+	}
+
+	// Read the body of the response, and restore it for the client
+	received := time.Now()
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	timings.Receive = millis(time.Since(received))
+
+	entry.Response = r.response(resp, responseBody)
+	entry.Time = millis(time.Since(start))
+	if err != nil {
+		entry.Comment = err.Error()
+		r.add(entry)
+		return nil, err
+	}
+	r.add(entry)
+	return resp, nil
+}
+
+func (r *Recorder) add(entry *Entry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func (r *Recorder) request(req *http.Request, body []byte) *Request {
+	request := &Request{
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		HttpVersion: req.Proto,
+		Cookies:     []NameValue{},
+		Headers:     r.headers(req.Header),
+		QueryString: []NameValue{},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for _, cookie := range req.Cookies() {
+		request.Cookies = append(request.Cookies, r.cookie(cookie, "Cookie"))
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			request.QueryString = append(request.QueryString, NameValue{Name: name, Value: value})
+		}
+	}
+	if body != nil {
+		request.PostData = &PostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(body),
+		}
+	}
+	return request
+}
+
+func (r *Recorder) response(resp *http.Response, body []byte) *Response {
+	response := &Response{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HttpVersion: resp.Proto,
+		Cookies:     []NameValue{},
+		Headers:     r.headers(resp.Header),
+		Content: &Content{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     string(body),
+		},
+		RedirectUrl: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for _, cookie := range resp.Cookies() {
+		response.Cookies = append(response.Cookies, r.cookie(cookie, "Set-Cookie"))
+	}
+	return response
+}
+
+// Check if the values of a header must be redacted
+func (r *Recorder) redacted(name string) bool {
+	for _, redact := range r.Redact {
+		if strings.EqualFold(redact, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) headers(header http.Header) []NameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	headers := []NameValue{}
+	for _, name := range names {
+		values := header[name]
+		for _, value := range values {
+			if r.redacted(name) {
+				value = Redacted
+			}
+			headers = append(headers, NameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// The cookies are redacted with the header carrying them
+func (r *Recorder) cookie(cookie *http.Cookie, header string) NameValue {
+	value := cookie.Value
+	if r.redacted(header) {
+		value = Redacted
+	}
+	return NameValue{Name: cookie.Name, Value: value}
+}
+
+// The archive of the recorded exchanges
+func (r *Recorder) Har() *Har {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return &Har{
+		Log: &Log{
+			Version: "1.2",
+			Creator: &Creator{Name: "gograph", Version: "1.0"},
+			Entries: append([]*Entry{}, r.entries...),
+		},
+	}
+}
+
+func (r *Recorder) Write(w io.Writer) error {
+	// The encoder writes the whole file at once, the secrets are masked in the bodies too
+	encoder := json.NewEncoder(secret.Writer(w))
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.Har())
+}
+
+func (r *Recorder) WriteFile(file string) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return r.Write(out)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
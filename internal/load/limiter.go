@@ -0,0 +1,55 @@
+package load
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// A http.RoundTripper counting the requests and limiting their rate
+//
+// The requests wait for the limit with Wait, see flow.RateLimiter, so that the
+// time waiting is not part of their latency.
+type limitedTransport struct {
+	transport http.RoundTripper
+	ticker    *time.Ticker
+
+	requests atomic.Int64
+}
+
+// Create a transport allowing at most rps requests per second, no limit if rps is 0
+func newLimitedTransport(transport http.RoundTripper, rps int) *limitedTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	t := &limitedTransport{transport: transport}
+	if rps > 0 {
+		t.ticker = time.NewTicker(time.Second / time.Duration(rps))
+	}
+	return t
+}
+
+// Wait until the rate limit allows a request
+func (t *limitedTransport) Wait(ctx context.Context) error {
+	if t.ticker == nil {
+		return nil
+	}
+	select {
+	case <-t.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.transport.RoundTrip(req)
+}
+
+func (t *limitedTransport) Stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
@@ -0,0 +1,138 @@
+package load
+
+import (
+	"context"
+	"gograph/internal/flow"
+	"gograph/internal/log"
+	"gograph/internal/template"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options of a load run
+type Options struct {
+	// Number of virtual users running the flow in a loop
+	Vus int
+	// Duration of the run, the running iterations are completed
+	Duration time.Duration
+	// Maximum number of requests per second, no limit if 0
+	Rps int
+	// Time to start all the virtual users, they are started at regular intervals
+	RampUp time.Duration
+	// Interval of the points of the time series
+	Interval time.Duration
+	// Seed of the random generators, shared by the virtual users
+	Seed int64
+	// Transport of the http requests
+	Transport http.RoundTripper
+	// Cancelled to stop the run before the end of the duration
+	Context context.Context
+}
+
+// Run a flow repeatedly with several virtual users
+//
+// Each iteration runs a copy of the flow with its own state, the iterations go
+// through the combinations of the matrix of the flow.
+func Run(definition *flow.FlowDefinition, options *Options) (*Result, error) {
+	if err := definition.LoadEnpoints(); err != nil {
+		return nil, err
+	}
+	template.Seed(options.Seed)
+
+	interval := options.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	transport := newLimitedTransport(options.Transport, options.Rps)
+	defer transport.Stop()
+	stats := newCollector()
+
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	runOptions := &flow.RunOption{
+		Seed:      &options.Seed,
+		KeepSeed:  true,
+		Transport: transport,
+		Logger:    log.Discard,
+	}
+
+	start := time.Now()
+	deadline := start.Add(options.Duration)
+	var vus atomic.Int64
+	var iterations atomic.Int64
+	flows := definition.Expand()
+	var wg sync.WaitGroup
+
+	// Run the flow until the deadline
+	vu := func(id int) {
+		defer wg.Done()
+
+		// Spread the start of the users over the ramp up
+		if options.RampUp > 0 && options.Vus > 1 {
+			select {
+			case <-time.After(options.RampUp * time.Duration(id) / time.Duration(options.Vus)):
+			case <-ctx.Done():
+				return
+			}
+		}
+		vus.Add(1)
+		defer vus.Add(-1)
+
+		for time.Now().Before(deadline) && ctx.Err() == nil {
+			// The iterations go through the combinations of the matrix
+			n := iterations.Add(1) - 1
+			runner := flow.NewFlowRunner(flows[n%int64(len(flows))].Clone())
+			runner.Run(runOptions)
+			for _, result := range runner.Results() {
+				if result.IsSkipped() {
+					continue
+				}
+				stats.addStep(result.Name, result.Duration, result.HasError())
+			}
+			stats.addIteration(runner.HasError())
+		}
+	}
+
+	wg.Add(options.Vus)
+	for i := 0; i < options.Vus; i++ {
+		go vu(i)
+	}
+
+	// Record the time series until all the users are done
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	series := []*Point{}
+	var requests int64
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case t := <-ticker.C:
+			total := transport.requests.Load()
+			series = append(series, stats.point(t, int(vus.Load()), total-requests))
+			requests = total
+		case <-done:
+			total := transport.requests.Load()
+			series = append(series, stats.point(time.Now(), 0, total-requests))
+			running = false
+		}
+	}
+
+	result := stats.result()
+	result.Name = definition.Name
+	result.Duration = time.Since(start)
+	result.Vus = options.Vus
+	result.Requests = transport.requests.Load()
+	result.Series = series
+	return result, nil
+}
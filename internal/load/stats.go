@@ -0,0 +1,255 @@
+package load
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Latency statistics of a set of runs
+type Latency struct {
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// Compute the percentiles of a list of durations, the list is sorted
+func newLatency(durations []time.Duration, errors int) *Latency {
+	slices.Sort(durations)
+	l := &Latency{Count: len(durations), Errors: errors}
+	if len(durations) > 0 {
+		l.P50 = percentile(durations, 50)
+		l.P90 = percentile(durations, 90)
+		l.P99 = percentile(durations, 99)
+		l.Max = durations[len(durations)-1]
+	}
+	return l
+}
+
+// Nearest rank percentile of a sorted list
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// A point of the time series, the values of one interval
+type Point struct {
+	Time       time.Time     `json:"time"`
+	Vus        int           `json:"vus"`
+	Iterations int           `json:"iterations"`
+	Requests   int64         `json:"requests"`
+	Errors     int           `json:"errors"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P99        time.Duration `json:"p99"`
+}
+
+// Result of a load run
+type Result struct {
+	Name       string              `json:"name"`
+	Duration   time.Duration       `json:"duration"`
+	Vus        int                 `json:"vus"`
+	Iterations int                 `json:"iterations"`
+	Failed     int                 `json:"failed"`
+	Requests   int64               `json:"requests"`
+	Steps      map[string]*Latency `json:"steps"`
+	Series     []*Point            `json:"series"`
+
+	stepOrder []string
+}
+
+// Iterations per second
+func (r *Result) IterationRate() float64 {
+	return float64(r.Iterations) / r.Duration.Seconds()
+}
+
+// Requests per second
+func (r *Result) RequestRate() float64 {
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// Ratio of the iterations with a failed step
+func (r *Result) ErrorRate() float64 {
+	if r.Iterations == 0 {
+		return 0
+	}
+	return float64(r.Failed) / float64(r.Iterations)
+}
+
+// Collect the durations of the steps during the run
+type collector struct {
+	mutex sync.Mutex
+
+	iterations int
+	failed     int
+	steps      map[string][]time.Duration
+	errors     map[string]int
+	order      []string
+
+	// Values of the current interval of the time series
+	interval struct {
+		iterations int
+		errors     int
+		durations  []time.Duration
+	}
+}
+
+func newCollector() *collector {
+	return &collector{
+		steps:  make(map[string][]time.Duration),
+		errors: make(map[string]int),
+	}
+}
+
+func (c *collector) addStep(name string, duration time.Duration, failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.steps[name]; !ok {
+		c.order = append(c.order, name)
+	}
+	c.steps[name] = append(c.steps[name], duration)
+	c.interval.durations = append(c.interval.durations, duration)
+	if failed {
+		c.errors[name]++
+		c.interval.errors++
+	}
+}
+
+func (c *collector) addIteration(failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.iterations++
+	c.interval.iterations++
+	if failed {
+		c.failed++
+	}
+}
+
+// Close the current interval of the time series
+func (c *collector) point(t time.Time, vus int, requests int64) *Point {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	latency := newLatency(c.interval.durations, 0)
+	p := &Point{
+		Time:       t,
+		Vus:        vus,
+		Iterations: c.interval.iterations,
+		Requests:   requests,
+		Errors:     c.interval.errors,
+		P50:        latency.P50,
+		P90:        latency.P90,
+		P99:        latency.P99,
+	}
+	c.interval.iterations = 0
+	c.interval.errors = 0
+	c.interval.durations = nil
+	return p
+}
+
+func (c *collector) result() *Result {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r := &Result{
+		Iterations: c.iterations,
+		Failed:     c.failed,
+		Steps:      make(map[string]*Latency),
+		stepOrder:  c.order,
+	}
+	for name, durations := range c.steps {
+		r.Steps[name] = newLatency(durations, c.errors[name])
+	}
+	return r
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
+
+// Print the summary of the run
+func (r *Result) Summarize(w io.Writer) {
+	fmt.Fprintf(w, "[%v] Load summary\n", r.Name)
+	fmt.Fprintf(w, "  duration:   %v, vus: %v\n", r.Duration.Round(time.Millisecond), r.Vus)
+	fmt.Fprintf(w, "  iterations: %v (%.1f/s), failed: %v (%.2f%%)\n", r.Iterations, r.IterationRate(), r.Failed, 100*r.ErrorRate())
+	fmt.Fprintf(w, "  requests:   %v (%.1f/s)\n", r.Requests, r.RequestRate())
+	fmt.Fprintln(w, "  steps:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tstep\tcount\terrors\tp50\tp90\tp99\tmax\t")
+	for _, name := range r.stepOrder {
+		l := r.Steps[name]
+		fmt.Fprintf(tw, "\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", name, l.Count, l.Errors,
+			formatLatency(l.P50), formatLatency(l.P90), formatLatency(l.P99), formatLatency(l.Max))
+	}
+	tw.Flush()
+}
+
+// Write the time series as CSV, the latencies are in milliseconds
+func (r *Result) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"time", "vus", "iterations", "requests", "errors", "p50_ms", "p90_ms", "p99_ms"})
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	}
+	for _, p := range r.Series {
+		out.Write([]string{
+			p.Time.Format(time.RFC3339),
+			strconv.Itoa(p.Vus),
+			strconv.Itoa(p.Iterations),
+			strconv.FormatInt(p.Requests, 10),
+			strconv.Itoa(p.Errors),
+			ms(p.P50),
+			ms(p.P90),
+			ms(p.P99),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Write the result and the time series as JSON, the durations are in nanoseconds
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Write the result to a file, or to the standard output if the file is empty or `-`
+//
+// The target is given as `<format>=<file>` or `<format>`, the format is csv or json
+func (r *Result) WriteTarget(target string) error {
+	format, file, _ := strings.Cut(target, "=")
+	write := func(w io.Writer) error {
+		switch format {
+		case "csv":
+			return r.WriteCSV(w)
+		case "json":
+			return r.WriteJSON(w)
+		default:
+			return fmt.Errorf("unknown output format: %v", format)
+		}
+	}
+
+	if len(file) == 0 || file == "-" {
+		return write(os.Stdout)
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return write(out)
+}
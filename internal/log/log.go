@@ -3,18 +3,24 @@ package log
 import (
 	"fmt"
 	"gograph/internal/global"
+	"gograph/internal/secret"
 	"log"
 	"os"
 )
 
 // All informative output goes to StdErr so that
 // we can print clean composable output
-var StdErr = log.New(os.Stderr, "", 0)
+//
+// The secrets are masked in all the output
+var StdErr = log.New(secret.Writer(os.Stderr), "", 0)
+
+// Application result
+var StdOut = secret.Writer(os.Stdout)
 
 // Display application result
-var Out = fmt.Print
-var Outln = fmt.Println
-var Outf = fmt.Printf
+var Out = func(a ...any) (int, error) { return fmt.Fprint(StdOut, a...) }
+var Outln = func(a ...any) (int, error) { return fmt.Fprintln(StdOut, a...) }
+var Outf = func(format string, a ...any) (int, error) { return fmt.Fprintf(StdOut, format, a...) }
 
 // Print an important message (always visible)
 var Print = StdErr.Print
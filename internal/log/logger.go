@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bytes"
+	"gograph/internal/global"
+	"io"
+	"log"
+)
+
+// Logger
+// ----------------------------------------
+//
+// Informative output of a unit of work, a flow or a step.
+//
+// A buffered logger keeps its output until it is flushed to its parent so that
+// the output of the flows and steps running in parallel is not interleaved.
+//
+// A nil logger writes directly to StdErr.
+type Logger struct {
+	std    *log.Logger
+	buffer *bytes.Buffer
+	parent *Logger
+}
+
+// A logger dropping all its output
+var Discard = &Logger{std: log.New(io.Discard, "", 0)}
+
+// A logger buffering its output until Flush is called
+func (l *Logger) Buffered() *Logger {
+	buffer := new(bytes.Buffer)
+	return &Logger{
+		std:    log.New(buffer, "", 0),
+		buffer: buffer,
+		parent: l,
+	}
+}
+
+// Write the buffered output to the parent logger
+func (l *Logger) Flush() {
+	if l == nil || l.buffer == nil {
+		return
+	}
+	if l.buffer.Len() > 0 {
+		l.parent.out().Print(l.buffer.String())
+		l.buffer.Reset()
+	}
+}
+
+func (l *Logger) out() *log.Logger {
+	if l == nil {
+		return StdErr
+	}
+	return l.std
+}
+
+// Print an important message (always visible)
+func (l *Logger) Print(v ...any) {
+	l.out().Print(v...)
+}
+
+func (l *Logger) Println(v ...any) {
+	l.out().Println(v...)
+}
+
+func (l *Logger) Printf(format string, v ...any) {
+	l.out().Printf(format, v...)
+}
+
+// Print verbose message (need -v)
+func (l *Logger) Verbose(v ...any) {
+	if global.Verbose || global.Debug {
+		l.out().Print(v...)
+	}
+}
+
+func (l *Logger) Verboseln(v ...any) {
+	if global.Verbose || global.Debug {
+		l.out().Println(v...)
+	}
+}
+
+func (l *Logger) Verbosef(format string, v ...any) {
+	if global.Verbose || global.Debug {
+		l.out().Printf(format, v...)
+	}
+}
+
+// Print debug message (need -d)
+func (l *Logger) Debug(v ...any) {
+	if global.Debug {
+		l.out().Print(v...)
+	}
+}
+
+func (l *Logger) Debugln(v ...any) {
+	if global.Debug {
+		l.out().Println(v...)
+	}
+}
+
+func (l *Logger) Debugf(format string, v ...any) {
+	if global.Debug {
+		l.out().Printf(format, v...)
+	}
+}
@@ -0,0 +1,81 @@
+package report
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"time"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+// A state value stored by a step
+type stateValue struct {
+	Name  string
+	Value string
+}
+
+// The values stored in the state by a step, sorted by name
+func stateValues(state map[string]interface{}) []stateValue {
+	names := make([]string, 0, len(state))
+	for name := range state {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	values := make([]stateValue, len(names))
+	for i, name := range names {
+		values[i] = stateValue{Name: name, Value: prettyJson(state[name])}
+	}
+	return values
+}
+
+// Indent a JSON value, a string that is not valid JSON is returned as is
+func prettyJson(v interface{}) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if s, ok := v.(string); ok {
+		var parsed interface{}
+		if json.Unmarshal([]byte(s), &parsed) != nil {
+			return s
+		}
+		v = parsed
+	}
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes.TrimRight(b.Bytes(), "\n"))
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// Write the report as a single HTML page, without external assets
+func (r *Report) WriteHTML(w io.Writer) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"json":        prettyJson,
+		"duration":    formatDuration,
+		"stateValues": stateValues,
+	}).Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+
+	steps, failures, skipped := r.Count()
+	return tmpl.Execute(w, map[string]interface{}{
+		"Report":    r,
+		"Steps":     steps,
+		"Failures":  failures,
+		"Skipped":   skipped,
+		"Generated": time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,133 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"gograph/internal/util"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	File       string           `xml:"file,attr,omitempty"`
+	Properties []junitProperty  `xml:"properties>property"`
+	Cases      []*junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// The request and response of a step as text
+func (step *Step) exchange() string {
+	var out strings.Builder
+	if step.Request != nil {
+		out.WriteString(fmt.Sprintf("Request (%v):\n", step.Request.Url))
+		out.WriteString(util.PrettyPrint(step.Request.Body))
+		out.WriteString("\n")
+	}
+	if step.Response != nil {
+		out.WriteString(fmt.Sprintf("Response (%v):\n", step.Response.StatusCode))
+		out.WriteString(step.Response.Body)
+		out.WriteString("\n")
+	}
+	if step.Timing != nil {
+		out.WriteString(fmt.Sprintf("Timing: %v\n", step.Timing))
+	}
+	return out.String()
+}
+
+// Write the report in JUnit XML format, each flow is a test suite and each step a test case
+func (r *Report) WriteJUnit(w io.Writer) error {
+	steps, failures, skipped := r.Count()
+	suites := &junitTestSuites{
+		Tests:    steps,
+		Failures: failures,
+		Skipped:  skipped,
+		Time:     junitTime(r.Duration),
+	}
+
+	for _, f := range r.Flows {
+		suite := &junitTestSuite{
+			Name: f.Name,
+			Time: junitTime(f.Duration),
+			File: f.File,
+			Properties: []junitProperty{
+				{Name: "seed", Value: fmt.Sprint(f.Seed)},
+			},
+		}
+		for _, step := range f.Steps {
+			testCase := &junitTestCase{
+				Name:      step.Name,
+				ClassName: f.Name,
+				Time:      junitTime(step.Duration),
+				SystemOut: step.exchange(),
+			}
+			if step.Status == StatusFailed {
+				testCase.Failure = &junitFailure{
+					Message: step.Errors[0],
+					Text:    strings.Join(step.Errors, "\n"),
+				}
+				suite.Failures++
+			}
+			if step.Status == StatusSkipped {
+				testCase.Skipped = &junitSkipped{Message: step.Skipped}
+				suite.Skipped++
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(suites)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
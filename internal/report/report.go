@@ -0,0 +1,228 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gograph/internal/flow"
+	"gograph/internal/secret"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Report of a run, one entry per flow
+type Report struct {
+	Flows    []*Flow       `json:"flows"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Flow struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	Seed     int64         `json:"seed"`
+	Duration time.Duration `json:"duration"`
+	Steps    []*Step       `json:"steps"`
+}
+
+type Step struct {
+	Name     string                        `json:"name"`
+	Status   string                        `json:"status"`
+	Errors   []string                      `json:"errors,omitempty"`
+	Skipped  string                        `json:"skipped,omitempty"`
+	Duration time.Duration                 `json:"duration"`
+	State    map[string]interface{}        `json:"state,omitempty"`
+	Request  *Request                      `json:"request,omitempty"`
+	Response *Response                     `json:"response,omitempty"`
+	Timing   *flow.GraphqlRunResult_Timing `json:"timing,omitempty"`
+}
+
+type Request struct {
+	Url    string                   `json:"url"`
+	Header http.Header              `json:"header"`
+	Body   *flow.GraphqlRequestBody `json:"body"`
+}
+
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Build the report of a list of flow runs
+func New(runners []*flow.FlowRunner) *Report {
+	report := &Report{Flows: []*Flow{}}
+	for _, runner := range runners {
+		definition := runner.Flow()
+		f := &Flow{
+			Name:  definition.Name,
+			File:  definition.File,
+			Seed:  runner.Seed(),
+			Steps: []*Step{},
+		}
+		for _, result := range runner.Results() {
+			if result == nil {
+				continue
+			}
+			f.Steps = append(f.Steps, newSteps(result, "")...)
+			f.Duration += result.Duration
+		}
+		report.Flows = append(report.Flows, f)
+		report.Duration += f.Duration
+	}
+	return report
+}
+
+// The steps of a result, the steps of a parallel group are listed under the name of the group
+//
+// A group failing on its own (retries, ...) is listed as a failed step before its children.
+func newSteps(result *flow.StepResult, prefix string) []*Step {
+	if len(result.Children) == 0 {
+		return []*Step{newStep(result, prefix)}
+	}
+	steps := []*Step{}
+	if len(result.Errors) > 0 {
+		group := &Step{
+			Name:     prefix + result.Name,
+			Status:   StatusFailed,
+			Duration: result.Duration,
+			State:    result.State,
+		}
+		for _, err := range result.Errors {
+			group.Errors = append(group.Errors, err.Error())
+		}
+		steps = append(steps, group)
+	}
+	for _, child := range result.Children {
+		steps = append(steps, newSteps(child, prefix+result.Name+" / ")...)
+	}
+	return steps
+}
+
+func newStep(result *flow.StepResult, prefix string) *Step {
+	step := &Step{
+		Name:     prefix + result.Name,
+		Status:   StatusPassed,
+		Duration: result.Duration,
+		State:    result.State,
+	}
+	if result.HasError() {
+		step.Status = StatusFailed
+	} else if result.IsSkipped() {
+		step.Status = StatusSkipped
+		step.Skipped = result.Skipped
+	}
+	for _, err := range result.Errors {
+		step.Errors = append(step.Errors, err.Error())
+	}
+
+	if runResult, ok := result.Result.(*flow.GraphqlRunResult); ok && runResult != nil {
+		if runResult.Request != nil {
+			step.Request = &Request{
+				Url:    runResult.Request.Url,
+				Header: maskHeader(runResult.Request.Header),
+				Body:   runResult.Request.Body,
+			}
+		}
+		if runResult.Reponse != nil {
+			step.Response = &Response{
+				StatusCode: runResult.Reponse.StatusCode,
+				Header:     maskHeader(runResult.Reponse.Header),
+				Body:       string(runResult.Reponse.Body),
+			}
+		}
+		step.Timing = runResult.Timing
+	}
+	return step
+}
+
+// Mask the value of the secret headers
+func maskHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	masked := header.Clone()
+	for _, name := range secret.Headers {
+		key := http.CanonicalHeaderKey(name)
+		if values, ok := masked[key]; ok {
+			masked[key] = make([]string, len(values))
+			for i := range values {
+				masked[key][i] = secret.Masked
+			}
+		}
+	}
+	return masked
+}
+
+// Count the steps, the failures and the skipped steps
+func (r *Report) Count() (steps int, failures int, skipped int) {
+	for _, f := range r.Flows {
+		for _, step := range f.Steps {
+			steps++
+			switch step.Status {
+			case StatusFailed:
+				failures++
+			case StatusSkipped:
+				skipped++
+			}
+		}
+	}
+	return steps, failures, skipped
+}
+
+// Write the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Write the report in the given format: json, junit, tap or html
+//
+// The report is rendered before being written to mask the secrets.
+func (r *Report) Write(format string, w io.Writer) error {
+	var b bytes.Buffer
+	var err error
+	switch format {
+	case "json":
+		err = r.WriteJSON(&b)
+	case "junit":
+		err = r.WriteJUnit(&b)
+	case "tap":
+		err = r.WriteTAP(&b)
+	case "html":
+		err = r.WriteHTML(&b)
+	default:
+		return fmt.Errorf("unknown report format: %v", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, secret.Mask(b.String()))
+	return err
+}
+
+// Write the report to a file, or to the standard output if the file is empty or `-`
+//
+// The target is given as `<format>=<file>` or `<format>`
+func (r *Report) WriteTarget(target string) error {
+	format, file, _ := strings.Cut(target, "=")
+	if len(file) == 0 || file == "-" {
+		return r.Write(format, os.Stdout)
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return r.Write(format, out)
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Quote a string for the TAP yaml block
+func tapQuote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+// Write the report in TAP version 13 format
+func (r *Report) WriteTAP(w io.Writer) error {
+	steps, _, _ := r.Count()
+
+	var out strings.Builder
+	out.WriteString("TAP version 13\n")
+	out.WriteString(fmt.Sprintf("1..%v\n", steps))
+
+	i := 0
+	for _, f := range r.Flows {
+		out.WriteString(fmt.Sprintf("# %v (seed: %v)\n", f.Name, f.Seed))
+		for _, step := range f.Steps {
+			i++
+			status := "ok"
+			if step.Status == StatusFailed {
+				status = "not ok"
+			}
+			if step.Status == StatusSkipped {
+				out.WriteString(fmt.Sprintf("ok %v - %v / %v # SKIP %v\n", i, f.Name, step.Name, step.Skipped))
+				continue
+			}
+			out.WriteString(fmt.Sprintf("%v %v - %v / %v\n", status, i, f.Name, step.Name))
+
+			out.WriteString("  ---\n")
+			out.WriteString(fmt.Sprintf("  duration_ms: %.3f\n", float64(step.Duration)/float64(time.Millisecond)))
+			if len(step.Errors) > 0 {
+				out.WriteString("  errors:\n")
+				for _, err := range step.Errors {
+					out.WriteString(fmt.Sprintf("    - %v\n", tapQuote(err)))
+				}
+			}
+			if step.Response != nil {
+				out.WriteString(fmt.Sprintf("  status: %v\n", step.Response.StatusCode))
+			}
+			out.WriteString("  ...\n")
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
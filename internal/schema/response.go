@@ -0,0 +1,290 @@
+package schema
+
+import (
+	"fmt"
+	"gograph/internal/util"
+	"math"
+	"slices"
+
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/ast"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/astparser"
+	"github.com/wundergraph/graphql-go-tools/v2/pkg/operationreport"
+)
+
+// Walk a query response alongside the query and the schema
+type responseValidator struct {
+	schema *Schema
+	query  *ast.Document
+	errors []error
+}
+
+func (v *responseValidator) errorf(path string, format string, args ...any) {
+	v.errors = append(v.errors, fmt.Errorf("%v: %v", path, fmt.Sprintf(format, args...)))
+}
+
+// Validate the `data` of a response against the schema
+//
+// The response is walked alongside the selection set of the query to report
+// non-null fields returned as null, invalid scalar values, unknown enum values,
+// and `__typename` not matching the union or interface of the field.
+func (s *Schema) ValidateResponse(query string, data interface{}) []error {
+	s.Normalize()
+
+	report := &operationreport.Report{}
+	document := ast.NewSmallDocument()
+	document.Input.ResetInputBytes([]byte(query))
+	astparser.NewParser().Parse(document, report)
+	if report.HasErrors() {
+		return []error{fmt.Errorf("unable to parse query: %v", report.Error())}
+	}
+
+	idx := slices.IndexFunc(document.RootNodes, func(n ast.Node) bool { return n.Kind == ast.NodeKindOperationDefinition })
+	if idx < 0 {
+		return []error{fmt.Errorf("no operation definition in query")}
+	}
+	operation := document.OperationDefinitions[document.RootNodes[idx].Ref]
+
+	// Find the root type of the operation
+	var rootTypeName string
+	switch operation.OperationType {
+	case ast.OperationTypeMutation:
+		rootTypeName = string(s.ast.Index.MutationTypeName)
+		if len(rootTypeName) == 0 {
+			rootTypeName = "Mutation"
+		}
+	case ast.OperationTypeSubscription:
+		rootTypeName = string(s.ast.Index.SubscriptionTypeName)
+		if len(rootTypeName) == 0 {
+			rootTypeName = "Subscription"
+		}
+	default:
+		rootTypeName = string(s.ast.Index.QueryTypeName)
+		if len(rootTypeName) == 0 {
+			rootTypeName = "Query"
+		}
+	}
+	rootNode, ok := s.ast.Index.FirstNodeByNameStr(rootTypeName)
+	if !ok {
+		return []error{fmt.Errorf("root type %v not found in schema", rootTypeName)}
+	}
+
+	if data == nil {
+		return nil
+	}
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return []error{fmt.Errorf("$.data: expected an object")}
+	}
+
+	v := &responseValidator{schema: s, query: document}
+	v.selectionSet(operation.SelectionSet, rootNode, rootTypeName, object, "$.data")
+	return v.errors
+}
+
+// Check an object against a selection set
+func (v *responseValidator) selectionSet(set int, parent ast.Node, parentName string, object map[string]interface{}, path string) {
+	schema := v.schema.ast
+	typename, _ := object["__typename"].(string)
+
+	for _, selectionRef := range v.query.SelectionSets[set].SelectionRefs {
+		selection := v.query.Selections[selectionRef]
+		switch selection.Kind {
+		case ast.SelectionKindField:
+			key := v.query.FieldAliasOrNameString(selection.Ref)
+			name := v.query.FieldNameString(selection.Ref)
+			value, present := object[key]
+			fieldPath := path + "." + key
+
+			if !present {
+				v.errorf(fieldPath, "selected field missing from the response")
+				continue
+			}
+			if name == "__typename" {
+				if _, ok := value.(string); !ok {
+					v.errorf(fieldPath, "expected a string, got %v", util.JsonPrint(value))
+				}
+				continue
+			}
+
+			definition, ok := schema.NodeFieldDefinitionByName(parent, []byte(name))
+			if !ok {
+				v.errorf(fieldPath, "field %v not found on type %v", name, parentName)
+				continue
+			}
+
+			field := v.query.Fields[selection.Ref]
+			childSet := ast.InvalidRef
+			if field.HasSelections {
+				childSet = field.SelectionSet
+			}
+			v.value(schema.FieldDefinitions[definition].Type, childSet, value, fieldPath)
+
+		case ast.SelectionKindInlineFragment:
+			fragment := v.query.InlineFragments[selection.Ref]
+			if !fragment.HasSelections {
+				continue
+			}
+			condition := v.query.InlineFragmentTypeConditionNameString(selection.Ref)
+			if len(condition) == 0 {
+				v.selectionSet(fragment.SelectionSet, parent, parentName, object, path)
+				continue
+			}
+			conditionNode, ok := schema.Index.FirstNodeByNameStr(condition)
+			if !ok {
+				v.errorf(path, "fragment type %v not found in schema", condition)
+				continue
+			}
+
+			if len(typename) > 0 {
+				// Only apply the fragment matching the concrete type
+				if !v.typeMatches(typename, condition, conditionNode) {
+					continue
+				}
+			} else if !v.fragmentPresent(fragment.SelectionSet, object) {
+				// Without __typename assume the fragment applies when all its fields are present
+				continue
+			}
+			v.selectionSet(fragment.SelectionSet, conditionNode, condition, object, path)
+		}
+	}
+}
+
+// Check if a concrete type matches a fragment type condition
+func (v *responseValidator) typeMatches(typename string, condition string, conditionNode ast.Node) bool {
+	schema := v.schema.ast
+	if typename == condition {
+		return true
+	}
+	switch conditionNode.Kind {
+	case ast.NodeKindInterfaceTypeDefinition:
+		node, ok := schema.Index.FirstNodeByNameStr(typename)
+		return ok && schema.NodeImplementsInterface(node, []byte(condition))
+	case ast.NodeKindUnionTypeDefinition:
+		members, _ := schema.UnionTypeDefinitionMemberTypeNames(conditionNode.Ref)
+		return slices.Contains(members, typename)
+	}
+	return false
+}
+
+// Check if all the fields selected by a fragment are present in the object
+func (v *responseValidator) fragmentPresent(set int, object map[string]interface{}) bool {
+	fields := v.query.SelectionSetFieldSelections(set)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, selectionRef := range fields {
+		key := v.query.FieldAliasOrNameString(v.query.Selections[selectionRef].Ref)
+		if _, ok := object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Check a value against a schema type
+func (v *responseValidator) value(typeRef int, set int, value interface{}, path string) {
+	schema := v.schema.ast
+	t := schema.Types[typeRef]
+
+	switch t.TypeKind {
+	case ast.TypeKindNonNull:
+		if value == nil {
+			v.errorf(path, "non-null field of type %v returned null", (&Type{schema: v.schema, ref: typeRef}).String())
+			return
+		}
+		v.value(t.OfType, set, value, path)
+		return
+	case ast.TypeKindList:
+		if value == nil {
+			return
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			v.errorf(path, "expected a list, got %v", util.JsonPrint(value))
+			return
+		}
+		for i, item := range list {
+			v.value(t.OfType, set, item, fmt.Sprintf("%v[%v]", path, i))
+		}
+		return
+	}
+
+	if value == nil {
+		return
+	}
+
+	name := schema.TypeNameString(typeRef)
+
+	// Built-in scalars
+	switch name {
+	case "Int":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) || n > math.MaxInt32 || n < math.MinInt32 {
+			v.errorf(path, "expected Int, got %v", util.JsonPrint(value))
+		}
+		return
+	case "Float":
+		if _, ok := value.(float64); !ok {
+			v.errorf(path, "expected Float, got %v", util.JsonPrint(value))
+		}
+		return
+	case "String":
+		if _, ok := value.(string); !ok {
+			v.errorf(path, "expected String, got %v", util.JsonPrint(value))
+		}
+		return
+	case "Boolean":
+		if _, ok := value.(bool); !ok {
+			v.errorf(path, "expected Boolean, got %v", util.JsonPrint(value))
+		}
+		return
+	case "ID":
+		switch n := value.(type) {
+		case string:
+		case float64:
+			if n != math.Trunc(n) {
+				v.errorf(path, "expected ID, got %v", util.JsonPrint(value))
+			}
+		default:
+			v.errorf(path, "expected ID, got %v", util.JsonPrint(value))
+		}
+		return
+	}
+
+	node, ok := schema.Index.FirstNodeByNameStr(name)
+	if !ok {
+		v.errorf(path, "type %v not found in schema", name)
+		return
+	}
+
+	switch node.Kind {
+	case ast.NodeKindScalarTypeDefinition:
+		// Custom scalars can't be checked
+	case ast.NodeKindEnumTypeDefinition:
+		s, ok := value.(string)
+		if !ok {
+			v.errorf(path, "expected enum %v, got %v", name, util.JsonPrint(value))
+		} else if !schema.EnumTypeDefinitionContainsEnumValue(node.Ref, []byte(s)) {
+			v.errorf(path, "value %v is not in enum %v", s, name)
+		}
+	case ast.NodeKindObjectTypeDefinition, ast.NodeKindInterfaceTypeDefinition, ast.NodeKindUnionTypeDefinition:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.errorf(path, "expected an object of type %v, got %v", name, util.JsonPrint(value))
+			return
+		}
+		if typename, ok := object["__typename"].(string); ok && !v.typeMatches(typename, name, node) {
+			switch node.Kind {
+			case ast.NodeKindObjectTypeDefinition:
+				v.errorf(path, "__typename %v doesn't match type %v", typename, name)
+			case ast.NodeKindInterfaceTypeDefinition:
+				v.errorf(path, "__typename %v doesn't implement interface %v", typename, name)
+			default:
+				v.errorf(path, "__typename %v is not a member of union %v", typename, name)
+			}
+		}
+		if set != ast.InvalidRef {
+			v.selectionSet(set, node, name, object, path)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The text replacing the secrets in the output
+const Masked = "*****"
+
+// Values shorter than this are not masked, they would mask unrelated output
+const MinLength = 4
+
+// Headers whose values are secrets
+var Headers = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+var (
+	mutex    sync.RWMutex
+	values   = make(map[string]bool)
+	replacer = strings.NewReplacer()
+)
+
+// Register a secret value, it is masked in all the output from now on
+//
+// The value is also masked in its JSON and HTML escaped forms.
+func Add(value string) {
+	if len(value) < MinLength {
+		return
+	}
+
+	forms := []string{value, html.EscapeString(value), htmltemplate.HTMLEscapeString(value)}
+	// The JSON of go escapes <, > and & unlike the JSON of most servers
+	for _, escapeHTML := range []bool{true, false} {
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(escapeHTML)
+		if err := encoder.Encode(value); err == nil {
+			quoted := strings.TrimSpace(b.String())
+			forms = append(forms, quoted[1:len(quoted)-1])
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	added := false
+	for _, form := range forms {
+		if !values[form] {
+			values[form] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// The longest values first, so that a secret containing another one is fully masked
+	sorted := make([]string, 0, len(values))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		pairs = append(pairs, v, Masked)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Register the secrets of a request header: the value of the `Authorization`
+// header and its credentials without the scheme, the values of the cookies
+func AddHeader(name, value string) {
+	name = http.CanonicalHeaderKey(name)
+	if !slices.Contains(Headers, name) {
+		return
+	}
+	Add(value)
+
+	switch name {
+	case "Authorization", "Proxy-Authorization":
+		if _, credentials, ok := strings.Cut(value, " "); ok {
+			Add(strings.TrimSpace(credentials))
+		}
+	case "Cookie":
+		for _, cookie := range strings.Split(value, ";") {
+			if _, v, ok := strings.Cut(cookie, "="); ok {
+				Add(strings.TrimSpace(v))
+			}
+		}
+	}
+}
+
+// Replace the secrets of a text
+func Mask(s string) string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return replacer.Replace(s)
+}
+
+// Replace the secrets in the strings of a JSON value
+func MaskValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case string:
+		return Mask(t)
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(t))
+		for key, item := range t {
+			masked[key] = MaskValue(item)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(t))
+		for i, item := range t {
+			masked[i] = MaskValue(item)
+		}
+		return masked
+	default:
+		return value
+	}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// A writer masking the secrets of each write
+//
+// A secret split over two writes is not masked, the writes must be complete
+// messages like the ones of the loggers.
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (m *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(m.w, Mask(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
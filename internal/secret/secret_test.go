@@ -0,0 +1,107 @@
+package secret
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The secrets are global, each test uses its own values
+
+func TestAdd(t *testing.T) {
+	Add(`p<a>"ss&word`)
+	Add("abc")
+	Add("wxyz")
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{`token p<a>"ss&word`, "token *****"},
+		// JSON escaped
+		{`{"token":"p<a>\"ss&word"}`, `{"token":"*****"}`},
+		{`{"token":"p\u003ca\u003e\"ss\u0026word"}`, `{"token":"*****"}`},
+		// HTML escaped
+		{`<td>p&lt;a&gt;&#34;ss&amp;word</td>`, "<td>*****</td>"},
+		// Shorter than MinLength
+		{"abc wxyz", "abc *****"},
+	}
+	for _, test := range tests {
+		if masked := Mask(test.text); masked != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, masked)
+		}
+	}
+}
+
+func TestAddLongestFirst(t *testing.T) {
+	Add("long")
+	Add("long-secret")
+
+	if masked := Mask("a long-secret"); masked != "a *****" {
+		t.Errorf("expected the longest secret to be masked, got %v", masked)
+	}
+}
+
+func TestAddHeader(t *testing.T) {
+	AddHeader("authorization", "Bearer header-token")
+	AddHeader("Cookie", "session=cookie-session; theme=dark-theme")
+	AddHeader("X-Request-Id", "request-id")
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Authorization: Bearer header-token", "Authorization: *****"},
+		{"token=header-token", "token=*****"},
+		{"session=cookie-session", "session=*****"},
+		{"theme=dark-theme", "theme=*****"},
+		// Only the secret headers are registered
+		{"id=request-id", "id=request-id"},
+		// The scheme alone is not a secret
+		{"Bearer other", "Bearer other"},
+	}
+	for _, test := range tests {
+		if masked := Mask(test.text); masked != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, masked)
+		}
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	Add("value-secret")
+
+	value := map[string]interface{}{
+		"token": "value-secret",
+		"list":  []interface{}{"a value-secret", 12, true, nil},
+		"count": 3.0,
+	}
+	expected := map[string]interface{}{
+		"token": Masked,
+		"list":  []interface{}{"a " + Masked, 12, true, nil},
+		"count": 3.0,
+	}
+	if masked := MaskValue(value); !reflect.DeepEqual(masked, expected) {
+		t.Errorf("expected %v, got %v", expected, masked)
+	}
+	if value["token"] != "value-secret" {
+		t.Errorf("expected the value to be left as is, got %v", value["token"])
+	}
+}
+
+func TestWriter(t *testing.T) {
+	Add("writer-secret")
+
+	var b strings.Builder
+	w := Writer(&b)
+	text := "the writer-secret is masked\n"
+	n, err := w.Write([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(text) {
+		t.Errorf("expected %v bytes written, got %v", len(text), n)
+	}
+	if b.String() != "the ***** is masked\n" {
+		t.Errorf("expected the secret to be masked, got %v", b.String())
+	}
+}
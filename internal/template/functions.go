@@ -0,0 +1,220 @@
+package template
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// Convert a value to its JSON representation
+//
+//	Usage:
+//	- { "ids": {{ toJson .State.IDS }} }
+func toJson(v interface{}) (string, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Decode a JSON string to a value
+//
+//	Usage:
+//	- {{ (fromJson .State.PAYLOAD).id }}
+func fromJson(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// Build a list from the arguments
+//
+//	Usage:
+//	- {{ list "a" "b" .State.C | toJson }}
+func list(values ...interface{}) []interface{} {
+	return values
+}
+
+// Return the value if it is not empty, the default otherwise
+//
+//	Usage:
+//	- {{ .State.LIMIT | default 10 }}
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// Check if a value is the zero value of its type, or an empty collection
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// Named layouts accepted by date
+var dateLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC822":      time.RFC822,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// Format a time using a go layout or one of the named layouts (RFC3339, DateOnly, ...)
+//
+//	Usage:
+//	- {{ now | date "2006-01-02" }}
+//	- {{ now | addDuration "24h" | date "RFC3339" }}
+func date(layout string, t interface{}) (string, error) {
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	switch t := t.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case int:
+		return time.Unix(int64(t), 0).Format(layout), nil
+	case int64:
+		return time.Unix(t, 0).Format(layout), nil
+	case float64:
+		return time.Unix(int64(t), 0).Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	default:
+		return "", fmt.Errorf("date: unsupported time value %v", t)
+	}
+}
+
+// Convert a template value to a number
+func toNumber(v interface{}) (float64, bool, error) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true, nil
+	case int64:
+		return float64(t), true, nil
+	case int32:
+		return float64(t), true, nil
+	case uint:
+		return float64(t), true, nil
+	case float64:
+		return t, t == float64(int64(t)), nil
+	case float32:
+		return float64(t), false, nil
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil && !strings.ContainsAny(t.String(), ".eE"), err
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil && !strings.ContainsAny(t, ".eE"), err
+	default:
+		return 0, false, fmt.Errorf("not a number: %v", v)
+	}
+}
+
+// Apply an arithmetic operation on a list of numbers
+//
+// The result is an int when all the operands are integers
+func arithmetic(name string, op func(a, b float64) (float64, error)) func(values ...interface{}) (interface{}, error) {
+	return func(values ...interface{}) (interface{}, error) {
+		if len(values) == 0 {
+			return 0, nil
+		}
+		result, allInt, err := toNumber(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+		for _, v := range values[1:] {
+			n, isInt, err := toNumber(v)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			allInt = allInt && isInt
+			if result, err = op(result, n); err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+		}
+		if allInt && result == float64(int64(result)) {
+			return int64(result), nil
+		}
+		return result, nil
+	}
+}
+
+func plus(a, b float64) (float64, error)  { return a + b, nil }
+func minus(a, b float64) (float64, error) { return a - b, nil }
+func times(a, b float64) (float64, error) { return a * b, nil }
+
+func divide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return a / b, nil
+}
+
+// Extract a value using a json path
+//
+//	Usage:
+//	- {{ jsonpath "$.USER.id" .State }}
+//	- {{ jsonpath "$.films[0].title" .State.RESULT }}
+func jsonpathGet(path string, data interface{}) (interface{}, error) {
+	return jsonpath.Get(path, data)
+}
+
+// Hex encoded sha256 of a string
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Decode a standard base64 string
+func base64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
+
+// Join the elements of a list using a separator
+//
+//	Usage:
+//	- {{ .State.TAGS | join "," }}
+func join(sep string, values interface{}) string {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Sprint(values)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
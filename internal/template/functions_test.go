@@ -0,0 +1,38 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"{{ add 1 2 3 }}", "6"},
+		{"{{ sub 5 2 }}", "3"},
+		{"{{ mul 2 2.5 }}", "5"},
+		{"{{ div 7 2 }}", "3.5"},
+		{"{{ div 6 2 }}", "3"},
+		{`{{ add "1" 2 }}`, "3"},
+	}
+	for _, test := range tests {
+		out, err := RunTemplate(test.text, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", test.text, err)
+		}
+		if out != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.text, test.expected, out)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	for _, text := range []string{"{{ div 1 0 }}", "{{ div 0 0.0 }}", "{{ div 4 2 0 }}"} {
+		_, err := RunTemplate(text, nil)
+		if err == nil || !strings.Contains(err.Error(), "div: division by zero") {
+			t.Errorf("%v: expected a division by zero error, got %v", text, err)
+		}
+	}
+}
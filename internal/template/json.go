@@ -0,0 +1,146 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+	gotemplate "text/template"
+	"text/template/parse"
+)
+
+// Functions whose output is already JSON and must not be converted again
+var jsonOutputFuncs = map[string]bool{
+	"json":       true,
+	"toJson":     true,
+	"jsonString": true,
+	"raw":        true,
+}
+
+// Print a value inside a JSON string, without the surrounding quotes
+//
+//	Usage:
+//	- { "name": "{{ .State.NAME | jsonString }}" }
+func jsonString(v interface{}) (string, error) {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		s = t
+	default:
+		j, err := toJson(t)
+		if err != nil {
+			return "", err
+		}
+		s = j
+	}
+	quoted, err := toJson(s)
+	if err != nil {
+		return "", err
+	}
+	return quoted[1 : len(quoted)-1], nil
+}
+
+// Update the string state of a JSON document after reading a chunk of text
+func scanJsonText(text string, inString bool) bool {
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inString:
+			escaped = true
+		case c == '"':
+			inString = !inString
+		}
+	}
+	return inString
+}
+
+// Append a function call to the pipeline of every printing action
+//
+// Actions inside a JSON string are escaped with jsonString, the others are converted with toJson
+func jsonEscapeList(tree *parse.Tree, list *parse.ListNode, inString bool) bool {
+	if list == nil {
+		return inString
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			inString = scanJsonText(string(node.Text), inString)
+		case *parse.ActionNode:
+			pipe := node.Pipe
+			if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+				continue
+			}
+			last := pipe.Cmds[len(pipe.Cmds)-1]
+			if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && jsonOutputFuncs[ident.Ident] {
+				continue
+			}
+			name := "toJson"
+			if inString {
+				name = "jsonString"
+			}
+			cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: node.Pos}
+			cmd.Args = []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(node.Pos)}
+			pipe.Cmds = append(pipe.Cmds, cmd)
+		case *parse.IfNode:
+			jsonEscapeList(tree, node.ElseList, inString)
+			inString = jsonEscapeList(tree, node.List, inString)
+		case *parse.RangeNode:
+			jsonEscapeList(tree, node.ElseList, inString)
+			inString = jsonEscapeList(tree, node.List, inString)
+		case *parse.WithNode:
+			jsonEscapeList(tree, node.ElseList, inString)
+			inString = jsonEscapeList(tree, node.List, inString)
+		}
+	}
+	return inString
+}
+
+// Run a template producing a JSON document
+//
+// Values are printed as JSON so that arrays, objects, numbers and nulls keep their
+// type, values printed inside a JSON string are escaped. Use `raw` to print a value
+// as is. It is used for the input of the steps with `jsonInput: true`, the
+// values of the templates written for RunTemplate would be encoded twice.
+//
+//	Usage:
+//	- { "id": "{{ .State.ID }}", "ids": {{ .State.IDS }}, "count": {{ .State.COUNT }} }
+func RunJsonTemplate(text string, context any) (string, error) {
+
+	tmpl := gotemplate.New("")
+	tmpl.Funcs(funcMap)
+	tmpl.Funcs(contextFuncs(context))
+
+	tmpl, err := tmpl.Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			jsonEscapeList(t.Tree, t.Tree.Root, false)
+		}
+	}
+
+	var b strings.Builder
+	release := useRandom(context)
+	err = tmpl.Execute(&b, context)
+	release()
+	if err != nil {
+		return "", err
+	}
+	r := strings.TrimSpace(b.String())
+
+	logger(context).Debugf("JSON template parsed:\n----input----\n%v\n----output----\n%v\n--------\n", text, r)
+
+	return r, nil
+}
+
+// Print a value as is, used to disable the conversion in JSON templates
+func raw(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
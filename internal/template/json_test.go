@@ -0,0 +1,73 @@
+package template
+
+import "testing"
+
+func TestRunJsonTemplate(t *testing.T) {
+	context := map[string]interface{}{
+		"Name":  `say "hi"`,
+		"Ids":   []interface{}{"a", "b"},
+		"Count": 3,
+		"Empty": nil,
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		// Inside a JSON string the values are escaped
+		{"string in quotes", `{"name": "{{ .Name }}"}`, `{"name": "say \"hi\""}`},
+		{"number in quotes", `{"count": "{{ .Count }}"}`, `{"count": "3"}`},
+		{"list in quotes", `{"ids": "{{ .Ids }}"}`, `{"ids": "[\"a\",\"b\"]"}`},
+		{"escaped quote before", `{"a": "\"{{ .Count }}"}`, `{"a": "\"3"}`},
+		{"already escaped in quotes", `{"name": "{{ .Name | jsonString }}"}`, `{"name": "say \"hi\""}`},
+
+		// Outside a string the values are printed as JSON
+		{"string outside quotes", `{"name": {{ .Name }}}`, `{"name": "say \"hi\""}`},
+		{"list outside quotes", `{"ids": {{ .Ids }}}`, `{"ids": ["a","b"]}`},
+		{"number outside quotes", `{"count": {{ .Count }}}`, `{"count": 3}`},
+		{"null outside quotes", `{"empty": {{ .Empty }}}`, `{"empty": null}`},
+		{"already encoded outside quotes", `{"ids": {{ toJson .Ids }}}`, `{"ids": ["a","b"]}`},
+		{"raw outside quotes", `{"count": {{ raw .Count }}}`, `{"count": 3}`},
+
+		// The string state is followed through the control structures
+		{"if in quotes", `{"name": "{{ if .Count }}{{ .Name }}{{ end }}"}`, `{"name": "say \"hi\""}`},
+		{"range outside quotes", `[{{ range .Ids }}{{ . }},{{ end }}0]`, `["a","b",0]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := RunJsonTemplate(test.text, context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, out)
+			}
+		})
+	}
+}
+
+// The input of the steps is a plain template unless `jsonInput` is set
+func TestRunTemplateKeepsEncodedValues(t *testing.T) {
+	context := map[string]interface{}{"Name": `say "hi"`}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"quoted with printf", `{"name": {{ printf "%q" .Name }}}`, `{"name": "say \"hi\""}`},
+		{"in quotes", `{"name": "{{ .Name }}"}`, `{"name": "say "hi""}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := RunTemplate(test.text, context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, out)
+			}
+		})
+	}
+}
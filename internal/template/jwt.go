@@ -0,0 +1,124 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Sign a set of claims and return the encoded JWT
+//
+// HMAC algorithms (HS256, HS384, HS512) use the key as secret, the others
+// expect a PEM encoded private key. time.Time claims are converted to unix
+// timestamps. Use jwtSignFile to read the key from a file.
+//
+//	Usage:
+//	- Bearer {{ jwtSign (dict "sub" .State.USER_ID "role" "admin") "HS256" (secret "JWT_SECRET") }}
+func jwtSign(claims map[string]interface{}, alg string, key string) (string, error) {
+	return sign("jwtSign", claims, alg, []byte(key))
+}
+
+// Sign a set of claims with the key read from a file and return the encoded JWT
+//
+// A relative path is read from the directory of the flow (or of the imported
+// file defining the step), it fails when the file can't be read.
+//
+//	Usage:
+//	- Bearer {{ jwtSignFile (dict "sub" "bob" "exp" (now | addDuration "1h")) "RS256" "keys/private.pem" }}
+func jwtSignFile(dir string) func(map[string]interface{}, string, string) (string, error) {
+	return func(claims map[string]interface{}, alg string, file string) (string, error) {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		key, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("jwtSignFile: %w", err)
+		}
+		return sign("jwtSignFile", claims, alg, key)
+	}
+}
+
+func sign(name string, claims map[string]interface{}, alg string, keyData []byte) (string, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return "", fmt.Errorf("%v: unsupported algorithm %v", name, alg)
+	}
+
+	mapClaims := jwt.MapClaims{}
+	for k, v := range claims {
+		switch t := v.(type) {
+		case time.Time:
+			mapClaims[k] = t.Unix()
+		default:
+			mapClaims[k] = v
+		}
+	}
+
+	var signingKey interface{}
+	var err error
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		signingKey = keyData
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		signingKey, err = jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	case strings.HasPrefix(alg, "ES"):
+		signingKey, err = jwt.ParseECPrivateKeyFromPEM(keyData)
+	case alg == "EdDSA":
+		signingKey, err = jwt.ParseEdPrivateKeyFromPEM(keyData)
+	default:
+		return "", fmt.Errorf("%v: unsupported algorithm %v", name, alg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v: invalid key for %v: %w", name, alg, err)
+	}
+
+	return jwt.NewWithClaims(method, mapClaims).SignedString(signingKey)
+}
+
+// Decode the claims of a JWT without verifying its signature
+//
+//	Usage:
+//	- {{ (jwtDecode .State.TOKEN).sub }}
+func jwtDecode(token string) (map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(strings.TrimSpace(token), claims)
+	if err != nil {
+		return nil, fmt.Errorf("jwtDecode: %w", err)
+	}
+	return claims, nil
+}
+
+// Add a duration to a time, the duration uses the go format (1h, 30m, -10s, ...)
+//
+//	Usage:
+//	- {{ now | addDuration "1h" }}
+func addDuration(duration string, t time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return t, err
+	}
+	return t.Add(d), nil
+}
+
+// Build a map from a list of key value pairs
+//
+//	Usage:
+//	- {{ dict "sub" "bob" "role" "admin" }}
+func dict(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("dict: expects an even number of arguments")
+	}
+	result := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", values[i])
+		}
+		result[key] = values[i+1]
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type dirContext struct {
+	flowContext
+	dir string
+}
+
+func (c *dirContext) TemplateDir() string { return c.dir }
+
+func TestJwtSignFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret.key"), []byte("s3cr3t"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	context := &dirContext{flowContext{NewRandom(1)}, dir}
+
+	fromFile, err := RunTemplate(`{{ jwtSignFile (dict "sub" "bob") "HS256" "secret.key" }}`, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromKey, err := RunTemplate(`{{ jwtSign (dict "sub" "bob") "HS256" "s3cr3t" }}`, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromFile != fromKey {
+		t.Errorf("expected the key of the file relative to the flow, got %v and %v", fromFile, fromKey)
+	}
+
+	_, err = RunTemplate(`{{ jwtSignFile (dict "sub" "bob") "HS256" "missing.key" }}`, context)
+	if err == nil || !strings.Contains(err.Error(), "missing.key") {
+		t.Errorf("expected an error for the missing key file, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package template
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	rdata "github.com/Pallinder/go-randomdata"
+	"github.com/google/uuid"
+)
+
+// A rand source safe for concurrent use
+type lockedReader struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Read(p)
+}
+
+// Random
+// ----------------------------------------
+//
+// Random generators of the template functions.
+//
+// The generators of rdata and uuid are global, the generators of a context are
+// installed for the time its template runs. The flows running in parallel have
+// their own generators so that their values only depend on their seed.
+type Random struct {
+	data *rand.Rand
+	uuid *lockedReader
+}
+
+// Random generators producing the same values for the same seed
+func NewRandom(seed int64) *Random {
+	return &Random{
+		data: rand.New(rand.NewSource(seed)),
+		uuid: &lockedReader{rand: rand.New(rand.NewSource(seed))},
+	}
+}
+
+// Generators for steps running at the same time, seeded in order from these
+// generators so that their values only depend on the seed of the flow
+//
+// The generators of a nil Random are nil, the steps use the default generators.
+func (r *Random) Split(n int) []*Random {
+	randoms := make([]*Random, n)
+	if r == nil {
+		return randoms
+	}
+	randomMutex.Lock()
+	defer randomMutex.Unlock()
+	for i := range randoms {
+		randoms[i] = NewRandom(r.data.Int63())
+	}
+	return randoms
+}
+
+// The generators of the templates whose context doesn't have its own
+var defaultRandom = NewRandom(time.Now().UnixNano())
+
+// The templates run one at a time while their generators are installed
+var randomMutex sync.Mutex
+
+// Seed the default random generators used by the template functions
+//
+// Running the same templates with the same seed produces the same values
+func Seed(seed int64) {
+	randomMutex.Lock()
+	defer randomMutex.Unlock()
+	defaultRandom = NewRandom(seed)
+}
+
+// Install the generators of a template context, the returned function releases them
+func useRandom(context any) func() {
+	randomMutex.Lock()
+	random := defaultRandom
+	if c, ok := context.(FlowContext); ok && c.TemplateRandom() != nil {
+		random = c.TemplateRandom()
+	}
+	rdata.CustomRand(random.data)
+	uuid.SetRand(random.uuid)
+	return randomMutex.Unlock
+}
+
+// A random gender drawn from the installed generators
+//
+// rdata draws the random genders from the global source of math/rand, the
+// names and emails would not follow the seed.
+func randomGender() int {
+	if rdata.Boolean() {
+		return rdata.Male
+	}
+	return rdata.Female
+}
+
+// An email built like rdata.Email with a gender drawn from the installed generators
+func randomEmail() string {
+	name := strings.ToLower(rdata.FirstName(randomGender())+rdata.LastName()) + rdata.StringNumberExt(1, "", 3)
+	// The domains are only available through rdata.Email, its own name is dropped
+	_, domain, _ := strings.Cut(rdata.Email(), "@")
+	return name + "@" + domain
+}
@@ -0,0 +1,88 @@
+package template
+
+import (
+	"gograph/internal/log"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+type flowContext struct {
+	random *Random
+}
+
+func (c *flowContext) TemplateLogger() *log.Logger { return log.Discard }
+func (c *flowContext) TemplateRandom() *Random     { return c.random }
+func (c *flowContext) TemplateDir() string         { return "" }
+
+// The values of a flow only depend on its seed, not on the templates run by the other flows
+func TestRandomOfContext(t *testing.T) {
+	text := `{{ uuid }} {{ randomEmail }}`
+
+	alone, err := RunTemplate(text, &flowContext{NewRandom(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &flowContext{NewRandom(42)}
+	other := &flowContext{NewRandom(7)}
+	if _, err := RunTemplate(text, other); err != nil {
+		t.Fatal(err)
+	}
+	interleaved, err := RunTemplate(text, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RunTemplate(text, other); err != nil {
+		t.Fatal(err)
+	}
+
+	if interleaved != alone {
+		t.Errorf("expected %v, got %v", alone, interleaved)
+	}
+	if second, _ := RunTemplate(text, first); second == alone {
+		t.Errorf("expected new values from the generators, got %v twice", second)
+	}
+}
+
+// The templates of the maps run in the same order for the same seed
+func TestValueTemplatesFollowSeed(t *testing.T) {
+	value := map[interface{}]interface{}{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		value[key] = "{{ uuid }}"
+	}
+
+	expected, err := RunValueTemplates(value, &flowContext{NewRandom(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		out, err := RunValueTemplates(value, &flowContext{NewRandom(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, expected) {
+			t.Fatalf("expected %v, got %v", expected, out)
+		}
+	}
+}
+
+// The values only depend on the seed, not on the global source of math/rand
+func TestRandomIgnoresGlobalSource(t *testing.T) {
+	text := `{{ randomTitle }} {{ randomFirstName }} {{ randomFullName }} {{ randomEmail }}`
+
+	expected, err := RunTemplate(text, &flowContext{NewRandom(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		rand.Intn(2)
+		out, err := RunTemplate(text, &flowContext{NewRandom(42)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Fatalf("expected %v, got %v", expected, out)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package template
 
 import (
+	"encoding/base64"
+	"fmt"
 	"gograph/internal/log"
+	"gograph/internal/secret"
 	"os"
 	"strings"
 	gotemplate "text/template"
+	"time"
 
 	rdata "github.com/Pallinder/go-randomdata"
+	"github.com/google/uuid"
 )
 
 // Read an environment variable
@@ -22,9 +27,94 @@ func env(envvar string, def ...string) string {
 	return value
 }
 
+// Read an environment variable holding a secret, the value is masked in all the output
+//
+//	Usage:
+//	- Bearer {{ secret "API_TOKEN" }}
+func secretEnv(envvar string) (string, error) {
+	value, exists := os.LookupEnv(envvar)
+	if !exists {
+		return "", fmt.Errorf("secret %v is not set", envvar)
+	}
+	secret.Add(value)
+	return value, nil
+}
+
 // Map of extra function for the template
 var funcMap = gotemplate.FuncMap{
-	"env": env,
+	"env":    env,
+	"secret": secretEnv,
+
+	// Build a map from key value pairs
+	"dict": dict,
+
+	// Current time
+	"now": time.Now,
+
+	// Add a go duration to a time
+	"addDuration": addDuration,
+
+	// Convert a time to a unix timestamp
+	"unix": func(t time.Time) int64 { return t.Unix() },
+
+	// Sign claims into a JWT, jwtSignFile reads the key from a file of the flow directory
+	"jwtSign":     jwtSign,
+	"jwtSignFile": jwtSignFile(""),
+
+	// Decode the claims of a JWT (the signature is not verified)
+	"jwtDecode": jwtDecode,
+
+	// Convert a value to JSON
+	"toJson": toJson,
+	"json":   toJson,
+
+	// Escape a value to be printed inside a JSON string
+	"jsonString": jsonString,
+
+	// Print a value as is in a JSON template
+	"raw": raw,
+
+	// Decode a JSON string
+	"fromJson": fromJson,
+
+	// Build a list from the arguments
+	"list": list,
+
+	// Use a default when the value is empty
+	"default": defaultValue,
+
+	// Extract a value using a json path: {{ jsonpath "$.USER.id" .State }}
+	"jsonpath": jsonpathGet,
+
+	// Print a random UUID v4
+	"uuid": func() string { return uuid.NewString() },
+
+	// Format a time using a go layout or a named layout (RFC3339, DateOnly, ...)
+	"date": date,
+
+	// Hex encoded sha256 of a string
+	"sha256": sha256Hex,
+
+	// Encode a string to base64
+	"base64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+
+	// Decode a base64 string
+	"base64dec": base64dec,
+
+	// Arithmetic, the result is an int if all the operands are integers
+	"add": arithmetic("add", plus),
+	"sub": arithmetic("sub", minus),
+	"mul": arithmetic("mul", times),
+	"div": arithmetic("div", divide),
+
+	// String manipulation
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"replace":  func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains": func(substr, s string) bool { return strings.Contains(s, substr) },
+	"split":    func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":     join,
 
 	"randSillyName": func() string { return rdata.SillyName() },
 
@@ -35,7 +125,7 @@ var funcMap = gotemplate.FuncMap{
 	"randomTitleFemale": func() string { return rdata.Title(rdata.Female) },
 
 	// Print a title with random gender
-	"randomTitle": func() string { return rdata.Title(rdata.RandomGender) },
+	"randomTitle": func() string { return rdata.Title(randomGender()) },
 
 	// Print a male first name
 	"randomFirstNameMale": func() string { return rdata.FirstName(rdata.Male) },
@@ -44,7 +134,7 @@ var funcMap = gotemplate.FuncMap{
 	"randomFirstNameFemale": func() string { return rdata.FirstName(rdata.Female) },
 
 	// Print a firstname with random gender
-	"randomFirstName": func() string { return rdata.FirstName(rdata.RandomGender) },
+	"randomFirstName": func() string { return rdata.FirstName(randomGender()) },
 
 	// Print a last name
 	"randomLastName": func() string { return rdata.LastName() },
@@ -56,10 +146,10 @@ var funcMap = gotemplate.FuncMap{
 	"randomFullNameFemale": func() string { return rdata.FullName(rdata.Female) },
 
 	// Print a name with random gender
-	"randomFullName": func() string { return rdata.FullName(rdata.RandomGender) },
+	"randomFullName": func() string { return rdata.FullName(randomGender()) },
 
 	// Print an email
-	"randomEmail": func() string { return rdata.Email() },
+	"randomEmail": randomEmail,
 
 	// Print a country with full text representation
 	"randomCountry": func() string { return rdata.Country(rdata.FullCountry) },
@@ -152,14 +242,70 @@ var funcMap = gotemplate.FuncMap{
 	"randomProvinceForCountry": func(country string) string { return rdata.ProvinceForCountry(country) },
 }
 
+// A template context giving the logger and the random generators of its flow,
+// the output and the random values of the flows running in parallel are kept apart.
+// The files read by the templates are relative to its directory.
+type FlowContext interface {
+	TemplateLogger() *log.Logger
+	TemplateRandom() *Random
+	TemplateDir() string
+}
+
+// The functions depending on the template context
+func contextFuncs(context any) gotemplate.FuncMap {
+	dir := ""
+	if c, ok := context.(FlowContext); ok {
+		dir = c.TemplateDir()
+	}
+	return gotemplate.FuncMap{
+		"jwtSignFile": jwtSignFile(dir),
+	}
+}
+
+// The logger of a template context, a nil logger writes to StdErr
+func logger(context any) *log.Logger {
+	if c, ok := context.(FlowContext); ok {
+		return c.TemplateLogger()
+	}
+	return nil
+}
+
 // Run a template returning errors if any
 func RunTemplate(text string, context any) (string, error) {
+	r, err := execute(text, context)
+	if err != nil {
+		return "", err
+	}
+
+	logger(context).Debugf("Template parsed:\n----input----\n%v\n----output----\n%v\n--------\n", text, r)
+
+	return r, nil
+}
+
+// Run the template of a request header returning the input value on error
+//
+// The values of the secret headers are registered before being logged.
+func RunHeaderTemplate(name string, text string, context any) string {
+	r, err := execute(text, context)
+	if err != nil {
+		logger(context).Println("Failed to parse template", err)
+		return text
+	}
+	secret.AddHeader(name, r)
+
+	logger(context).Debugf("Template parsed:\n----input----\n%v\n----output----\n%v\n--------\n", text, r)
+
+	return r
+}
+
+func execute(text string, context any) (string, error) {
 
 	tmpl := gotemplate.New("")
 
 	// Setup custom function
 
 	tmpl.Funcs(funcMap)
+	tmpl.Funcs(contextFuncs(context))
 
 	tmpl, err := tmpl.Parse(text)
 	if err != nil {
@@ -167,22 +313,20 @@ func RunTemplate(text string, context any) (string, error) {
 	}
 
 	var b strings.Builder
+	release := useRandom(context)
 	err = tmpl.Execute(&b, context)
+	release()
 	if err != nil {
 		return "", err
 	}
-	r := strings.TrimSpace(b.String())
-
-	log.Debugf("Template parsed:\n----input----\n%v\n----output----\n%v\n--------\n", text, r)
-
-	return r, nil
+	return strings.TrimSpace(b.String()), nil
 }
 
 // Run a template returning the input value on error
 func RunTemplateOrUnparsed(text string, context any) string {
 	out, err := RunTemplate(text, context)
 	if err != nil {
-		log.Println("Failed to parse template", err)
+		logger(context).Println("Failed to parse template", err)
 		return text
 	}
 	return out
@@ -0,0 +1,128 @@
+package template
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	gotemplate "text/template"
+	"text/template/parse"
+)
+
+// Name of the function capturing the value of a single expression template
+const captureFunc = "__capture"
+
+// Return the action node if the template is made of a single expression
+func singleAction(tree *parse.Tree) *parse.ActionNode {
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	var action *parse.ActionNode
+	for _, node := range tree.Root.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			if len(strings.TrimSpace(string(node.Text))) > 0 {
+				return nil
+			}
+		case *parse.ActionNode:
+			if action != nil || len(node.Pipe.Decl) > 0 {
+				return nil
+			}
+			action = node
+		default:
+			return nil
+		}
+	}
+	return action
+}
+
+// Run a template keeping the type of the value when the template is a single expression
+//
+//	Usage:
+//	- "{{ .State.IDS }}"          => []interface{}{...}
+//	- "{{ randomNumber 1 10 }}"   => int
+//	- "id-{{ .State.ID }}"        => string
+func RunTemplateValue(text string, context any) (any, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var captured any
+	tmpl := gotemplate.New("")
+	tmpl.Funcs(funcMap)
+	tmpl.Funcs(contextFuncs(context))
+	tmpl.Funcs(gotemplate.FuncMap{
+		captureFunc: func(v any) string {
+			captured = v
+			return ""
+		},
+	})
+
+	tmpl, err := tmpl.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	action := singleAction(tmpl.Tree)
+	if action == nil {
+		return RunTemplate(text, context)
+	}
+
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: action.Pos}
+	cmd.Args = []parse.Node{parse.NewIdentifier(captureFunc).SetTree(tmpl.Tree).SetPos(action.Pos)}
+	action.Pipe.Cmds = append(action.Pipe.Cmds, cmd)
+
+	var b strings.Builder
+	release := useRandom(context)
+	err = tmpl.Execute(&b, context)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	return captured, nil
+}
+
+// Run the templates in every string of a structured value (maps, lists, scalars)
+//
+// Maps decoded from yaml are converted to map[string]interface{} so that the result
+// can be encoded to JSON. The keys of the maps are run in sorted order so that the
+// random values only depend on the seed.
+func RunValueTemplates(value any, context any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return RunTemplateValue(v, context)
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = item
+		}
+		return RunValueTemplates(converted, context)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		result := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			parsed, err := RunValueTemplates(v[key], context)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = parsed
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			parsed, err := RunValueTemplates(item, context)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = parsed
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}